@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// atomicWriteFile writes data to a temporary file next to path, syncs it and
+// renames it over path, so a crash never leaves a truncated file behind
+func atomicWriteFile(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	tmp, err := os.CreateTemp(dir, "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	cleanup := func() {
+		tmp.Close()
+		os.Remove(tmpName)
+	}
+	if _, err := tmp.Write(data); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		cleanup()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	// Persist the rename itself
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+	return nil
+}
+
+// backupDir is where timestamped copies of path are kept
+func backupDir(path string) string {
+	return filepath.Join(filepath.Dir(path), "backups")
+}
+
+// backupName returns the timestamped backup file name for path
+func backupName(path string, t time.Time) string {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	return fmt.Sprintf("%s-%s%s", strings.TrimSuffix(base, ext), t.Format("20060102-150405"), ext)
+}
+
+// backupInterval is the least time between two backups. Each CLI command
+// is a session of its own, so without it a few quick start and stop calls
+// would replace every older backup.
+const backupInterval = time.Hour
+
+// listBackups returns the backups of path, oldest first
+func listBackups(path string) ([]string, error) {
+	base := filepath.Base(path)
+	ext := filepath.Ext(base)
+	pattern := filepath.Join(backupDir(path), strings.TrimSuffix(base, ext)+"-*"+ext)
+	matches, err := filepath.Glob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	// Timestamps sort lexically
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// backupDue reports whether the newest backup of path is older than
+// backupInterval, or there is none
+func backupDue(path string) bool {
+	backups, err := listBackups(path)
+	if err != nil || len(backups) == 0 {
+		return true
+	}
+	info, err := os.Stat(backups[len(backups)-1])
+	return err != nil || time.Since(info.ModTime()) >= backupInterval
+}
+
+// pruneBackups removes the oldest backups of path so at most keep remain
+func pruneBackups(path string, keep int) error {
+	matches, err := listBackups(path)
+	if err != nil {
+		return err
+	}
+	for len(matches) > keep {
+		if err := os.Remove(matches[0]); err != nil {
+			return err
+		}
+		matches = matches[1:]
+	}
+	return nil
+}
+
+// backupFile copies path into the backup directory and rotates old copies,
+// unless the newest copy is less than backupInterval old. A missing path is
+// not an error since there is nothing to protect yet.
+func backupFile(path string, keep int) error {
+	if keep <= 0 || !backupDue(path) {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(backupDir(path), 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(backupDir(path), backupName(path, time.Now()))
+	if err := atomicWriteFile(dest, data, 0644); err != nil {
+		return err
+	}
+	return pruneBackups(path, keep)
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// roundEnvVar sets the billing increment when --round is unset
+const roundEnvVar = "FISHTIME_ROUND"
+
+// billingIncrement is the step billed time is rounded up to, in seconds.
+// Zero bills exact time.
+var billingIncrement int64
+
+// parseIncrement reads a billing increment given as minutes ("15") or a
+// duration ("6m", "1h")
+func parseIncrement(s string) (int64, error) {
+	s = strings.TrimSpace(s)
+	if n, err := strconv.Atoi(s); err == nil && n >= 0 {
+		return int64(n) * 60, nil
+	}
+	d, err := time.ParseDuration(s)
+	if err != nil || d < 0 {
+		return 0, fmt.Errorf("invalid rounding %q (use minutes such as 6 or 15, or a duration such as 6m)", s)
+	}
+	return int64(d.Seconds()), nil
+}
+
+// billedSeconds rounds a record's duration up to the billing increment
+func billedSeconds(seconds int64) int64 {
+	if billingIncrement <= 0 || seconds%billingIncrement == 0 {
+		return seconds
+	}
+	return (seconds/billingIncrement + 1) * billingIncrement
+}
+
+// hourlyRate is the rate and currency that apply to a project
+type hourlyRate struct {
+	rate     float64
+	currency string
+}
+
+// projectRates resolves the rate of every project. Each of rate and currency
+// is taken from the project itself or else its nearest ancestor that sets
+// it, so a client's rate covers all of its projects.
+func projectRates(projects []projectEntry) map[string]hourlyRate {
+	rates := make(map[string]hourlyRate, len(projects))
+	// The tree lists parents first, so theirs are already resolved
+	for _, e := range projectTree(projects) {
+		r := rates[e.ParentID]
+		if e.Rate > 0 {
+			r.rate = e.Rate
+		}
+		if e.Currency != "" {
+			r.currency = e.Currency
+		}
+		rates[e.ID] = r
+	}
+	return rates
+}
+
+// projectRate returns the hourly rate and currency that apply to one project
+func projectRate(projects []projectEntry, id string) (float64, string) {
+	r := projectRates(projects)[id]
+	return r.rate, r.currency
+}
+
+// parseRate reads a rate as typed in the rate popup or on the command line,
+// "80" or "80 EUR". Empty clears the rate.
+func parseRate(s string) (float64, string, error) {
+	fields := strings.Fields(s)
+	if len(fields) == 0 {
+		return 0, "", nil
+	}
+	if len(fields) > 2 {
+		return 0, "", fmt.Errorf("invalid rate %q (use an amount and optional currency such as 80 EUR)", s)
+	}
+	rate, err := strconv.ParseFloat(strings.ReplaceAll(fields[0], ",", "."), 64)
+	if err != nil || rate < 0 {
+		return 0, "", fmt.Errorf("invalid rate %q (use an amount and optional currency such as 80 EUR)", s)
+	}
+	currency := ""
+	if len(fields) == 2 {
+		currency = strings.ToUpper(fields[1])
+	}
+	return rate, currency, nil
+}
+
+// formatMoney writes an amount as "450.00 EUR", or "450.00" without a
+// currency
+func formatMoney(amount float64, currency string) string {
+	return strings.TrimSpace(fmt.Sprintf("%.2f %s", amount, currency))
+}
+
+// formatRate writes a rate as "80.00 EUR/h", empty when there is none
+func formatRate(rate float64, currency string) string {
+	if rate == 0 {
+		return ""
+	}
+	return formatMoney(rate, currency) + "/h"
+}
+
+// earnings sums amounts per currency; "" is for projects without one
+type earnings map[string]float64
+
+// earningsOf sums what billable records earn at their project's rate, after
+// rounding each record to the billing increment
+func earningsOf(records []record, projects []projectEntry) earnings {
+	e := make(earnings)
+	rates := projectRates(projects)
+	for _, r := range records {
+		rate := rates[r.ProjectID]
+		if r.NonBillable || rate.rate == 0 {
+			continue
+		}
+		e[rate.currency] += float64(billedSeconds(r.Duration)) / 3600 * rate.rate
+	}
+	return e
+}
+
+// String writes the amounts as "450.00 EUR + 120.00 USD", empty when
+// nothing was earned
+func (e earnings) String() string {
+	currencies := make([]string, 0, len(e))
+	for currency := range e {
+		currencies = append(currencies, currency)
+	}
+	sort.Strings(currencies)
+	parts := make([]string, len(currencies))
+	for i, currency := range currencies {
+		parts[i] = formatMoney(e[currency], currency)
+	}
+	return strings.Join(parts, " + ")
+}
+
+// fishtime rate <project> [AMOUNT [CURRENCY]] shows or sets a project's
+// hourly rate; 0 clears it so the parent's applies
+func cmdRate(store Store, args []string, out io.Writer) error {
+	if len(args) == 0 {
+		return errors.New("missing project name")
+	}
+	projects, err := store.Projects()
+	if err != nil {
+		return err
+	}
+	p, err := lookupProject(projects, args[0])
+	if err != nil {
+		return err
+	}
+	path := projectPaths(projects)[p.ID]
+	if len(args) > 1 {
+		rate, currency, err := parseRate(strings.Join(args[1:], " "))
+		if err != nil {
+			return err
+		}
+		for i := range projects {
+			if projects[i].ID == p.ID {
+				projects[i].Rate, projects[i].Currency = rate, currency
+			}
+		}
+		if err := store.SaveProjects(projects); err != nil {
+			return err
+		}
+	}
+	rate, currency := projectRate(projects, p.ID)
+	if rate == 0 {
+		fmt.Fprintf(out, "%s has no rate\n", path)
+		return nil
+	}
+	fmt.Fprintf(out, "%s bills %s\n", path, formatRate(rate, currency))
+	return nil
+}
@@ -0,0 +1,187 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/charmbracelet/lipgloss"
+)
+
+// projectPalette colors projects in the chart view, by their position in
+// the project list
+var projectPalette = []lipgloss.Color{"69", "42", "214", "205", "81", "141", "203", "227", "37", "177"}
+
+// heatmapLevels shade heatmap days from least to most time
+var heatmapLevels = []string{"░", "▒", "▓", "█"}
+
+// projectColor returns the chart color of a project
+func (m model) projectColor(id string) lipgloss.Color {
+	i := m.projectIndex(id)
+	if i < 0 {
+		return lipgloss.Color("240")
+	}
+	return projectPalette[i%len(projectPalette)]
+}
+
+// dayKey identifies a local calendar day
+func dayKey(t time.Time) string {
+	return t.Local().Format("2006-01-02")
+}
+
+// dailyTotals sums records per local start day and project
+func dailyTotals(records []record) map[string]map[string]int64 {
+	days := make(map[string]map[string]int64)
+	for _, r := range records {
+		key := dayKey(r.StartTime)
+		if days[key] == nil {
+			days[key] = make(map[string]int64)
+		}
+		days[key][r.ProjectID] += r.Duration
+	}
+	return days
+}
+
+// dayTotal sums one day's per-project totals
+func dayTotal(projects map[string]int64) int64 {
+	var total int64
+	for _, seconds := range projects {
+		total += seconds
+	}
+	return total
+}
+
+// chartDays lists the days of the selected period, open ends clamped to the
+// first record and today
+func (m model) chartDays(records []record) []time.Time {
+	from, to := m.periodRange()
+	now := time.Now()
+	if from.IsZero() {
+		from = now
+		for _, r := range records {
+			if r.StartTime.Before(from) {
+				from = r.StartTime
+			}
+		}
+	}
+	if to.IsZero() {
+		to = now
+	}
+	from = from.Local()
+	day := time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.Local)
+	var days []time.Time
+	for ; day.Before(to); day = day.AddDate(0, 0, 1) {
+		days = append(days, day)
+	}
+	return days
+}
+
+// renderChart draws hours per day for the shown records above a year
+// heatmap of daily totals, both colored by project
+func (m model) renderChart(width, height int) string {
+	records := m.filteredRecords()
+	totals := dailyTotals(records)
+	lines := []string{summaryTitleStyle.Render("Hours per Day")}
+
+	// Heatmap takes a title, 7 weekday rows and a legend line
+	barRows := max(height-len(lines)-11, 1)
+	days := m.chartDays(records)
+	if len(days) > barRows {
+		days = days[len(days)-barRows:]
+	}
+	var most int64
+	for _, d := range days {
+		most = max(most, dayTotal(totals[dayKey(d)]))
+	}
+	// label (10), hours (6) and the spaces between them
+	barWidth := max(width-10-6-2, 1)
+	for _, d := range days {
+		day := totals[dayKey(d)]
+		var bar strings.Builder
+		for _, p := range m.allProjects {
+			if seconds := day[p.ID]; seconds > 0 && most > 0 {
+				n := max(int(float64(seconds)/float64(most)*float64(barWidth)+0.5), 1)
+				bar.WriteString(lipgloss.NewStyle().Foreground(m.projectColor(p.ID)).Render(strings.Repeat("█", n)))
+			}
+		}
+		hours := float64(dayTotal(day)) / 3600
+		lines = append(lines, fmt.Sprintf("%s %5.1fh %s", d.Format("Mon 01-02"), hours, bar.String()))
+	}
+
+	lines = append(lines, "", summaryTitleStyle.Render("Year"))
+	lines = append(lines, m.renderHeatmap(totals, days, width)...)
+	lines = append(lines, m.renderLegend(records, width))
+	return lipgloss.NewStyle().Height(height).MaxHeight(height).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+// renderHeatmap draws one column per week and one row per weekday for the
+// year up to the end of the shown days. Each day is shaded by its total and
+// colored by the project it had the most time for.
+func (m model) renderHeatmap(totals map[string]map[string]int64, days []time.Time, width int) []string {
+	end := time.Now()
+	if len(days) > 0 {
+		end = days[len(days)-1]
+	}
+	end = time.Date(end.Year(), end.Month(), end.Day(), 0, 0, 0, 0, time.Local)
+	weeks := min(53, max(width-4, 1))
+	// Columns start on the configured first day of the week
+	start := end.AddDate(0, 0, -(int(end.Weekday()-weekStart)+7)%7-7*(weeks-1))
+
+	var most int64
+	for d := start; !d.After(end); d = d.AddDate(0, 0, 1) {
+		most = max(most, dayTotal(totals[dayKey(d)]))
+	}
+	empty := lipgloss.NewStyle().Foreground(lipgloss.Color("238")).Render("·")
+
+	rows := make([]string, 7)
+	for row := range rows {
+		weekday := (weekStart + time.Weekday(row)) % 7
+		label := "   "
+		if row%2 == 0 {
+			label = weekday.String()[:3]
+		}
+		var b strings.Builder
+		b.WriteString(label + " ")
+		for week := 0; week < weeks; week++ {
+			d := start.AddDate(0, 0, 7*week+row)
+			if d.After(end) {
+				break
+			}
+			day := totals[dayKey(d)]
+			total := dayTotal(day)
+			if total == 0 {
+				b.WriteString(empty)
+				continue
+			}
+			top := ""
+			for _, p := range m.allProjects {
+				if day[p.ID] > day[top] {
+					top = p.ID
+				}
+			}
+			level := min(int(float64(total)/float64(most)*float64(len(heatmapLevels))), len(heatmapLevels)-1)
+			b.WriteString(lipgloss.NewStyle().Foreground(m.projectColor(top)).Render(heatmapLevels[level]))
+		}
+		rows[row] = b.String()
+	}
+	return rows
+}
+
+// renderLegend names the colors of the projects in records
+func (m model) renderLegend(records []record, width int) string {
+	seen := make(map[string]bool)
+	for _, r := range records {
+		seen[r.ProjectID] = true
+	}
+	paths := projectPaths(m.allProjects)
+	var parts []string
+	for _, p := range m.allProjects {
+		if seen[p.ID] {
+			parts = append(parts, lipgloss.NewStyle().Foreground(m.projectColor(p.ID)).Render("█")+" "+paths[p.ID])
+		}
+	}
+	if len(parts) == 0 {
+		return "No records in this period"
+	}
+	return lipgloss.NewStyle().MaxWidth(width).Render(strings.Join(parts, "  "))
+}
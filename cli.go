@@ -0,0 +1,235 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// runCommand runs a non-interactive subcommand against store and returns
+// instead of starting the TUI
+func runCommand(store Store, args []string, out io.Writer) error {
+	switch args[0] {
+	case "start":
+		return cmdStart(store, args[1:], out)
+	case "stop":
+		return cmdStop(store, args[1:], out)
+	case "switch":
+		return cmdSwitch(store, args[1:], out)
+	case "status":
+		return cmdStatus(store, args[1:], out)
+	case "report":
+		return cmdReport(store, args[1:], out)
+	case "export":
+		return cmdExport(store, args[1:], out)
+	case "import":
+		return cmdImport(store, args[1:], out)
+	case "rate":
+		return cmdRate(store, args[1:], out)
+	case "invoice":
+		return cmdInvoice(store, args[1:], out)
+	}
+	return fmt.Errorf("unknown command %q (use start, stop, switch, status, report, export, import, rate or invoice)", args[0])
+}
+
+// findProject looks up an active project for the CLI by its path, such as
+// "Acme/Website", or its own name when that is unambiguous
+func findProject(store Store, name string) (projectEntry, error) {
+	if name == "" {
+		return projectEntry{}, errors.New("missing project name")
+	}
+	projects, err := store.Projects()
+	if err != nil {
+		return projectEntry{}, err
+	}
+	p, err := lookupProject(projects, name)
+	if err != nil {
+		return projectEntry{}, err
+	}
+	if p.Archived {
+		return projectEntry{}, fmt.Errorf("project %q is archived; restore it in the TUI first", name)
+	}
+	return p, nil
+}
+
+// projectName returns the path of the project with the given ID
+func projectName(store Store, id string) string {
+	projects, _ := store.Projects()
+	return projectPaths(projects)[id]
+}
+
+// startTimer starts the timer for project, which must not be running
+func startTimer(store Store, project projectEntry, out io.Writer) error {
+	if err := store.SaveTimer(timerState{Running: true, Start: time.Now(), ProjectID: project.ID}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Started %s\n", projectName(store, project.ID))
+	return nil
+}
+
+// stopTimer records the running timer's session with an optional note and
+// stops it
+func stopTimer(store Store, timer timerState, note string, out io.Writer) error {
+	r := record{
+		ID:        newID(),
+		ProjectID: timer.ProjectID,
+		Duration:  int64(time.Since(timer.Start).Seconds()),
+		StartTime: timer.Start,
+		Note:      strings.TrimSpace(note),
+	}
+	// Both in one write, so a failure cannot record the session twice
+	if err := store.StopTimer(r, timerState{Start: timer.Start}); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Stopped %s after %s\n", projectName(store, timer.ProjectID), formatDuration(r.Duration))
+	return nil
+}
+
+// fishtime start <project>
+func cmdStart(store Store, args []string, out io.Writer) error {
+	project, err := findProject(store, strings.Join(args, " "))
+	if err != nil {
+		return err
+	}
+	timer, err := store.Timer()
+	if err != nil {
+		return err
+	}
+	if timer.Running {
+		return fmt.Errorf("timer already running for %s since %s; use switch to change project",
+			projectName(store, timer.ProjectID), timer.Start.Format("15:04"))
+	}
+	return startTimer(store, project, out)
+}
+
+// fishtime stop [--note TEXT]
+func cmdStop(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("stop", flag.ContinueOnError)
+	note := fs.String("note", "", "what the session was for")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("stop takes no arguments besides --note")
+	}
+	timer, err := store.Timer()
+	if err != nil {
+		return err
+	}
+	if !timer.Running {
+		return errors.New("no timer running")
+	}
+	return stopTimer(store, timer, *note, out)
+}
+
+// fishtime switch [--note TEXT] <project> stops the running timer, if any,
+// and starts one for project. The note goes on the stopped session.
+func cmdSwitch(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("switch", flag.ContinueOnError)
+	note := fs.String("note", "", "what the stopped session was for")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	project, err := findProject(store, strings.Join(fs.Args(), " "))
+	if err != nil {
+		return err
+	}
+	timer, err := store.Timer()
+	if err != nil {
+		return err
+	}
+	if timer.Running {
+		if timer.ProjectID == project.ID {
+			fmt.Fprintf(out, "Already timing %s\n", projectName(store, project.ID))
+			return nil
+		}
+		if err := stopTimer(store, timer, *note, out); err != nil {
+			return err
+		}
+	}
+	return startTimer(store, project, out)
+}
+
+// statusInfo describes the running timer for `fishtime status`
+type statusInfo struct {
+	Running        bool       `json:"running"`
+	Project        string     `json:"project,omitempty"`
+	Start          *time.Time `json:"start_time,omitempty"`
+	ElapsedSeconds int64      `json:"elapsed_seconds"`
+	TodaySeconds   int64      `json:"today_seconds"` // Today's total for the project, including the running session
+}
+
+// Elapsed formats the running session as hh:mm:ss for --format templates
+func (s statusInfo) Elapsed() string { return formatDuration(s.ElapsedSeconds) }
+
+// Today formats today's total for the project as hh:mm:ss
+func (s statusInfo) Today() string { return formatDuration(s.TodaySeconds) }
+
+// currentStatus reads the timer state and today's total for its project
+func currentStatus(store Store, now time.Time) (statusInfo, error) {
+	timer, err := store.Timer()
+	if err != nil || !timer.Running {
+		return statusInfo{}, err
+	}
+	records, err := store.Records()
+	if err != nil {
+		return statusInfo{}, err
+	}
+	start := timer.Start
+	info := statusInfo{
+		Running:        true,
+		Project:        projectName(store, timer.ProjectID),
+		Start:          &start,
+		ElapsedSeconds: int64(now.Sub(timer.Start).Seconds()),
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	info.TodaySeconds = info.ElapsedSeconds
+	for _, r := range records {
+		if r.ProjectID == timer.ProjectID && !r.StartTime.Before(midnight) {
+			info.TodaySeconds += r.Duration
+		}
+	}
+	return info, nil
+}
+
+// fishtime status [--json | --format TEMPLATE]
+func cmdStatus(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("status", flag.ContinueOnError)
+	asJSON := fs.Bool("json", false, "print the status as JSON")
+	format := fs.String("format", "", "print the status with a Go template, e.g. '{{if .Running}}{{.Project}} {{.Elapsed}}{{end}}'")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return errors.New("status takes no arguments")
+	}
+	info, err := currentStatus(store, time.Now())
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case *asJSON:
+		return json.NewEncoder(out).Encode(info)
+	case *format != "":
+		tmpl, err := template.New("status").Parse(*format)
+		if err != nil {
+			return fmt.Errorf("invalid --format: %w", err)
+		}
+		if err := tmpl.Execute(out, info); err != nil {
+			return err
+		}
+		fmt.Fprintln(out)
+		return nil
+	case !info.Running:
+		fmt.Fprintln(out, "Timer: Off")
+		return nil
+	}
+	fmt.Fprintf(out, "%s %s (since %s)\n", info.Project, info.Elapsed(), info.Start.Format("15:04"))
+	return nil
+}
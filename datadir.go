@@ -0,0 +1,107 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/charmbracelet/x/term"
+)
+
+const (
+	dataFileName   = "timer_data.json"
+	sqliteFileName = "timer_data.db"
+	dataEnvVar     = "FISHTIME_DATA"
+)
+
+// resolveDataDir picks the data directory: the --data flag, then
+// $FISHTIME_DATA, then $XDG_DATA_HOME/fishtime, then ~/.local/share/fishtime
+func resolveDataDir(flagValue string) (string, error) {
+	if flagValue != "" {
+		return flagValue, nil
+	}
+	if dir := os.Getenv(dataEnvVar); dir != "" {
+		return dir, nil
+	}
+	if xdg := os.Getenv("XDG_DATA_HOME"); xdg != "" && filepath.IsAbs(xdg) {
+		return filepath.Join(xdg, "fishtime"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot find a data directory, use --data or $%s: %w", dataEnvVar, err)
+	}
+	return filepath.Join(home, ".local", "share", "fishtime"), nil
+}
+
+// hasData reports whether dir already holds data for any backend
+func hasData(dir string) bool {
+	for _, name := range []string{dataFileName, sqliteFileName} {
+		if _, err := os.Stat(filepath.Join(dir, name)); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// legacyDataFile returns the path of a timer_data.json left in the working
+// directory by older versions, or "" if there is none to migrate into dir
+func legacyDataFile(dir string) string {
+	legacy, err := filepath.Abs(dataFileName)
+	if err != nil {
+		return ""
+	}
+	if absDir, err := filepath.Abs(dir); err == nil && filepath.Dir(legacy) == absDir {
+		return ""
+	}
+	if _, err := os.Stat(legacy); err != nil || hasData(dir) {
+		return ""
+	}
+	return legacy
+}
+
+// offerLegacyMigration asks whether to move a legacy ./timer_data.json into
+// dir. Without a terminal to ask on it only prints a hint.
+func offerLegacyMigration(dir string, in io.Reader, out io.Writer, interactive bool) error {
+	legacy := legacyDataFile(dir)
+	if legacy == "" {
+		return nil
+	}
+	if !interactive {
+		fmt.Fprintf(out, "Note: found %s from an older version; run fishtime in a terminal to migrate it to %s\n", legacy, dir)
+		return nil
+	}
+	fmt.Fprintf(out, "Found %s from an older version.\nMove it to %s? [Y/n] ", legacy, dir)
+	answer, err := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	// Enter alone accepts, but input that ends before a full line does not
+	if err != nil || answer != "" && answer != "y" && answer != "yes" {
+		fmt.Fprintf(out, "Leaving it in place; pass --data %s to keep using it.\n", filepath.Dir(legacy))
+		return nil
+	}
+	return migrateLegacyData(legacy, dir)
+}
+
+// migrateLegacyData copies legacy into dir and renames the original so it is
+// not offered again
+func migrateLegacyData(legacy, dir string) error {
+	data, err := os.ReadFile(legacy)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+	if err := atomicWriteFile(filepath.Join(dir, dataFileName), data, 0644); err != nil {
+		return err
+	}
+	return os.Rename(legacy, legacy+".migrated")
+}
+
+// isTerminal reports whether f is attached to a terminal; character devices
+// such as /dev/null are not
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(f.Fd())
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// exporters maps export format names to the function writing them
+var exporters = map[string]func(w io.Writer, records []record, names map[string]string) error{
+	"csv":  writeCSV,
+	"json": writeJSONLines,
+	"md":   writeMarkdown,
+	"ics":  writeICS,
+}
+
+// exportFormats lists the format names for help and error messages
+func exportFormats() string {
+	formats := make([]string, 0, len(exporters))
+	for name := range exporters {
+		formats = append(formats, name)
+	}
+	sort.Strings(formats)
+	return strings.Join(formats, ", ")
+}
+
+// sortedByStart returns a copy of records in chronological order
+func sortedByStart(records []record) []record {
+	sorted := append([]record(nil), records...)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].StartTime.Before(sorted[j].StartTime) })
+	return sorted
+}
+
+// recordEnd returns when a record's session ended
+func recordEnd(r record) time.Time {
+	return r.StartTime.Add(time.Duration(r.Duration) * time.Second)
+}
+
+func writeCSV(w io.Writer, records []record, names map[string]string) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "project", "start", "end", "duration", "seconds", "note", "tags", "billable", "invoice"})
+	for _, r := range sortedByStart(records) {
+		cw.Write([]string{
+			r.ID,
+			names[r.ProjectID],
+			r.StartTime.Local().Format(time.RFC3339),
+			recordEnd(r).Local().Format(time.RFC3339),
+			formatDuration(r.Duration),
+			strconv.FormatInt(r.Duration, 10),
+			r.Note,
+			strings.Join(recordTags(r), " "),
+			strconv.FormatBool(!r.NonBillable),
+			r.Invoice,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeJSONLines writes one JSON object per record
+func writeJSONLines(w io.Writer, records []record, names map[string]string) error {
+	enc := json.NewEncoder(w)
+	for _, r := range sortedByStart(records) {
+		err := enc.Encode(struct {
+			ID              string    `json:"id"`
+			Project         string    `json:"project"`
+			Start           time.Time `json:"start"`
+			End             time.Time `json:"end"`
+			DurationSeconds int64     `json:"duration_seconds"`
+			Note            string    `json:"note,omitempty"`
+			Tags            []string  `json:"tags,omitempty"`
+			Billable        bool      `json:"billable"`
+			Invoice         string    `json:"invoice,omitempty"`
+		}{r.ID, names[r.ProjectID], r.StartTime.Local(), recordEnd(r).Local(), r.Duration, r.Note, recordTags(r), !r.NonBillable, r.Invoice})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeMarkdown writes a timesheet table with a subtotal after each day
+func writeMarkdown(w io.Writer, records []record, names map[string]string) error {
+	fmt.Fprintln(w, "| Date | Project | Start | End | Duration | Note | Tags |")
+	fmt.Fprintln(w, "|------|---------|-------|-----|---------:|------|------|")
+	var day string
+	var subtotal, total int64
+	flushDay := func() {
+		if day != "" {
+			fmt.Fprintf(w, "| | | | **%s total** | **%s** | | |\n", day, formatDuration(subtotal))
+		}
+	}
+	for _, r := range sortedByStart(records) {
+		start := r.StartTime.Local()
+		if d := start.Format("2006-01-02"); d != day {
+			flushDay()
+			day, subtotal = d, 0
+		}
+		fmt.Fprintf(w, "| %s | %s | %s | %s | %s | %s | %s |\n", day, markdownEscape(names[r.ProjectID]),
+			start.Format("15:04"), recordEnd(r).Local().Format("15:04"), formatDuration(r.Duration),
+			markdownEscape(r.Note), formatTags(recordTags(r)))
+		subtotal += r.Duration
+		total += r.Duration
+	}
+	flushDay()
+	_, err := fmt.Fprintf(w, "| | | | **Total** | **%s** | | |\n", formatDuration(total))
+	return err
+}
+
+// markdownEscape keeps pipes and line breaks in names and notes from
+// breaking table cells
+func markdownEscape(s string) string {
+	return strings.NewReplacer("|", `\|`, "\n", " ").Replace(s)
+}
+
+// exportRecords writes records in format to path, or to out when path is ""
+func exportRecords(out io.Writer, path, format string, records []record, names map[string]string) error {
+	write, ok := exporters[format]
+	if !ok {
+		return fmt.Errorf("unknown export format %q (use %s)", format, exportFormats())
+	}
+	if path == "" {
+		return write(out, records, names)
+	}
+	var buf bytes.Buffer
+	if err := write(&buf, records, names); err != nil {
+		return err
+	}
+	return atomicWriteFile(path, buf.Bytes(), 0644)
+}
+
+// defaultExportPath names an export file in the working directory
+func defaultExportPath(format string, now time.Time) string {
+	name := "fishtime-" + now.Format("20060102-150405") + "." + format
+	if abs, err := filepath.Abs(name); err == nil {
+		return abs
+	}
+	return name
+}
+
+// fishtime export [--format FORMAT] [--period NAME] [--from DATE] [--to DATE] [--project NAME]... [-o FILE]
+func cmdExport(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "csv", "output format: "+exportFormats())
+	from := fs.String("from", "", "first day to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day to include (YYYY-MM-DD)")
+	period := fs.String("period", "All", "only include records from this Period pane entry: "+strings.Join(periodNames, ", "))
+	output := fs.String("o", "", "write to this file instead of standard output")
+	var projectNames, tagNames multiFlag
+	fs.Var(&projectNames, "project", "only include this project (repeatable)")
+	fs.Var(&tagNames, "tag", "only include records with this tag (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+
+	f, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	f.Tags = tagFilter(tagNames)
+	name, ok := lookupPeriod(*period)
+	if !ok {
+		return fmt.Errorf("invalid --period %q (use %s)", *period, strings.Join(periodNames, ", "))
+	}
+	if start := periodStart(name, time.Now()); start.After(f.From) {
+		f.From = start
+	}
+	projects, err := store.Projects()
+	if err != nil {
+		return err
+	}
+	if f.ProjectIDs, err = projectIDs(projects, projectNames); err != nil {
+		return err
+	}
+	records, err := store.Records()
+	if err != nil {
+		return err
+	}
+	filtered := filterRecords(records, projects, f)
+	if err := exportRecords(out, *output, *format, filtered, projectPaths(projects)); err != nil {
+		return err
+	}
+	if *output != "" {
+		fmt.Fprintf(os.Stderr, "Exported %d records to %s\n", len(filtered), *output)
+	}
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Projects form a tree through ParentID: clients at the top, their projects
+// below and optional tasks below those. Records can belong to any level and
+// count towards every ancestor.
+
+// maxProjectDepth is how many levels the tree has: client, project, task
+const maxProjectDepth = 3
+
+// pathSeparator joins names along the tree, as in "Acme/Website/Design"
+const pathSeparator = "/"
+
+// projectTreeEntry is a project with its depth in the tree
+type projectTreeEntry struct {
+	projectEntry
+	depth       int
+	hasChildren bool
+}
+
+// projectTree lists projects depth first, children after their parent in
+// the order of projects. Projects whose parent is missing become roots.
+func projectTree(projects []projectEntry) []projectTreeEntry {
+	exists := make(map[string]bool, len(projects))
+	for _, p := range projects {
+		exists[p.ID] = true
+	}
+	children := make(map[string][]projectEntry)
+	for _, p := range projects {
+		parent := p.ParentID
+		if !exists[parent] || parent == p.ID {
+			parent = ""
+		}
+		children[parent] = append(children[parent], p)
+	}
+
+	tree := make([]projectTreeEntry, 0, len(projects))
+	visited := make(map[string]bool, len(projects))
+	var walk func(parent string, depth int)
+	walk = func(parent string, depth int) {
+		for _, p := range children[parent] {
+			if visited[p.ID] {
+				continue
+			}
+			visited[p.ID] = true
+			tree = append(tree, projectTreeEntry{p, depth, len(children[p.ID]) > 0})
+			walk(p.ID, depth+1)
+		}
+	}
+	walk("", 0)
+	return tree
+}
+
+// projectPaths maps project IDs to their full path
+func projectPaths(projects []projectEntry) map[string]string {
+	paths := make(map[string]string, len(projects))
+	var parents []string
+	for _, e := range projectTree(projects) {
+		parents = append(parents[:e.depth], e.Name)
+		paths[e.ID] = strings.Join(parents, pathSeparator)
+	}
+	return paths
+}
+
+// projectAncestors maps project IDs to their ancestors' IDs, root first
+func projectAncestors(projects []projectEntry) map[string][]string {
+	ancestors := make(map[string][]string, len(projects))
+	var chain []string
+	for _, e := range projectTree(projects) {
+		chain = append(chain[:e.depth], e.ID)
+		ancestors[e.ID] = append([]string(nil), chain[:e.depth]...)
+	}
+	return ancestors
+}
+
+// withDescendants returns ids together with every project below them
+func withDescendants(projects []projectEntry, ids map[string]bool) map[string]bool {
+	all := make(map[string]bool, len(ids))
+	for id, ancestors := range projectAncestors(projects) {
+		if ids[id] {
+			all[id] = true
+			continue
+		}
+		for _, a := range ancestors {
+			if ids[a] {
+				all[id] = true
+				break
+			}
+		}
+	}
+	return all
+}
+
+// lookupProject finds a project by its full path or, when unambiguous, by
+// its own name
+func lookupProject(projects []projectEntry, name string) (projectEntry, error) {
+	paths := projectPaths(projects)
+	var matches []projectEntry
+	for _, p := range projects {
+		if paths[p.ID] == name {
+			return p, nil
+		}
+		if p.Name == name {
+			matches = append(matches, p)
+		}
+	}
+	switch len(matches) {
+	case 0:
+		return projectEntry{}, fmt.Errorf("project %q does not exist", name)
+	case 1:
+		return matches[0], nil
+	}
+	return projectEntry{}, fmt.Errorf("project name %q is ambiguous, use the full path such as %q", name, paths[matches[0].ID])
+}
+
+// ensureProjectPath returns the ID of the project at path, creating missing
+// levels. It returns the updated projects and the paths it created, or an
+// error when path is deeper than the tree allows.
+func ensureProjectPath(projects []projectEntry, path string) (string, []projectEntry, []string, error) {
+	var names []string
+	for _, name := range strings.Split(path, pathSeparator) {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) > maxProjectDepth {
+		return "", projects, nil, fmt.Errorf("project path %q has %d levels, at most %d are supported", path, len(names), maxProjectDepth)
+	}
+
+	paths := projectPaths(projects)
+	var created []string
+	parent, sofar := "", ""
+	for _, name := range names {
+		if sofar != "" {
+			sofar += pathSeparator
+		}
+		sofar += name
+		id := ""
+		for _, p := range projects {
+			if paths[p.ID] == sofar {
+				id = p.ID
+				break
+			}
+		}
+		if id == "" {
+			id = newID()
+			projects = append(projects, projectEntry{ID: id, Name: name, ParentID: parent})
+			paths[id] = sofar
+			created = append(created, sofar)
+		}
+		parent = id
+	}
+	return parent, projects, created, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// historyLimit bounds how many actions can be undone
+const historyLimit = 100
+
+// snapshot captures everything an undoable action can change
+type snapshot struct {
+	projects []projectEntry
+	records  []record
+	timer    timerState
+}
+
+// historyEntry is one undoable action and the state before (for undo) or
+// after it (for redo)
+type historyEntry struct {
+	desc  string
+	state snapshot
+}
+
+// history holds the undo and redo stacks for the current session
+type history struct {
+	undo []historyEntry
+	redo []historyEntry
+}
+
+// snapshot copies the persisted parts of the model
+func (m model) snapshot() snapshot {
+	return snapshot{
+		projects: append([]projectEntry(nil), m.allProjects...),
+		records:  append([]record(nil), m.records...),
+		timer: timerState{
+			Running:   m.timerRunning,
+			Start:     m.timerStart,
+			ProjectID: m.timerProjectID,
+		},
+	}
+}
+
+// checkpoint remembers the current state before an action described by desc
+// changes it. A new action makes previously undone ones unreachable.
+func (m *model) checkpoint(desc string) {
+	m.history.undo = append(m.history.undo, historyEntry{desc: desc, state: m.snapshot()})
+	if len(m.history.undo) > historyLimit {
+		m.history.undo = m.history.undo[len(m.history.undo)-historyLimit:]
+	}
+	m.history.redo = nil
+}
+
+// undo reverts the last action
+func (m *model) undo() {
+	if len(m.history.undo) == 0 {
+		m.statusMessage = "Nothing to undo"
+		return
+	}
+	e := m.history.undo[len(m.history.undo)-1]
+	m.history.undo = m.history.undo[:len(m.history.undo)-1]
+	m.history.redo = append(m.history.redo, historyEntry{desc: e.desc, state: m.snapshot()})
+	m.restore(e.state)
+	m.statusMessage = "Undid: " + e.desc
+}
+
+// redo applies the last undone action again
+func (m *model) redo() {
+	if len(m.history.redo) == 0 {
+		m.statusMessage = "Nothing to redo"
+		return
+	}
+	e := m.history.redo[len(m.history.redo)-1]
+	m.history.redo = m.history.redo[:len(m.history.redo)-1]
+	m.history.undo = append(m.history.undo, historyEntry{desc: e.desc, state: m.snapshot()})
+	m.restore(e.state)
+	m.statusMessage = "Redid: " + e.desc
+}
+
+// restore replaces the model's data with s and writes only the differences
+// to the store
+func (m *model) restore(s snapshot) {
+	var added, changed []record
+	current := make(map[string]record, len(m.records))
+	for _, r := range m.records {
+		current[r.ID] = r
+	}
+	for _, r := range s.records {
+		old, ok := current[r.ID]
+		if !ok {
+			added = append(added, r)
+		} else if !sameRecord(old, r) {
+			changed = append(changed, r)
+		}
+		delete(current, r.ID)
+	}
+	var removed []string
+	for id := range current {
+		removed = append(removed, id)
+	}
+	// One write per kind of change, however many records it touches
+	var errs []error
+	if len(added) > 0 {
+		errs = append(errs, m.store.AddRecords(added))
+	}
+	if len(changed) > 0 {
+		errs = append(errs, m.store.UpdateRecords(changed))
+	}
+	if len(removed) > 0 {
+		errs = append(errs, m.store.DeleteRecords(removed))
+	}
+	errs = append(errs, m.store.SaveProjects(s.projects), m.store.SaveTimer(s.timer))
+	m.reportSave(errors.Join(errs...))
+
+	m.allProjects = s.projects
+	m.records = s.records
+	m.timerRunning = s.timer.Running
+	m.timerStart = s.timer.Start
+	m.timerProjectID = s.timer.ProjectID
+	m.refreshProjects()
+	m.refreshLogs()
+}
+
+// sameRecord reports whether two versions of a record are identical. Whole
+// records are compared so fields added later cannot be missed.
+func sameRecord(a, b record) bool {
+	return reflect.DeepEqual(normalizeRecord(a), normalizeRecord(b))
+}
+
+// normalizeRecord drops differences that are not changes: the location and
+// monotonic clock reading of StartTime, and nil versus empty tags
+func normalizeRecord(r record) record {
+	r.StartTime = r.StartTime.Round(0).UTC()
+	if len(r.Tags) == 0 {
+		r.Tags = nil
+	}
+	return r
+}
+
+// describeRecord names a record in undo messages
+func (m model) describeRecord(r record) string {
+	return fmt.Sprintf("%s %s", projectPaths(m.allProjects)[r.ProjectID], formatDuration(r.Duration))
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// storedRecord reads record id through a new handle on dir, so it sees what
+// reached the disk
+func storedRecord(t *testing.T, dir, backend, id string) record {
+	t.Helper()
+	s, err := openStore(storeOptions{Dir: dir, Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	records, err := s.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, r := range records {
+		if r.ID == id {
+			return r
+		}
+	}
+	t.Fatalf("record %s is missing", id)
+	return record{}
+}
+
+// recordJSON writes r in a form that compares equal whatever location its
+// start time was read in
+func recordJSON(t *testing.T, r record) string {
+	t.Helper()
+	r.StartTime = r.StartTime.UTC()
+	data, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data)
+}
+
+func TestUndoRedoRecordFields(t *testing.T) {
+	// Every field but ID needs an edit here; ID is what identifies a record
+	edits := map[string]func(r *record){
+		"ProjectID":   func(r *record) { r.ProjectID = "b" },
+		"Duration":    func(r *record) { r.Duration += 600 },
+		"StartTime":   func(r *record) { r.StartTime = r.StartTime.Add(time.Hour) },
+		"Note":        func(r *record) { r.Note = "edited" },
+		"Tags":        func(r *record) { r.Tags = []string{"edited"} },
+		"NonBillable": func(r *record) { r.NonBillable = true },
+		"Invoice":     func(r *record) { r.Invoice = "0001" },
+	}
+	fields := reflect.TypeOf(record{})
+	for i := 0; i < fields.NumField(); i++ {
+		if name := fields.Field(i).Name; name != "ID" && edits[name] == nil {
+			t.Errorf("no edit for record field %s", name)
+		}
+	}
+
+	original := record{
+		ID:        "r1",
+		ProjectID: "a",
+		Duration:  3600,
+		StartTime: time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC),
+		Note:      "original",
+		Tags:      []string{"original"},
+	}
+	for _, backend := range []string{"json", "sqlite"} {
+		for field, edit := range edits {
+			t.Run(backend+"/"+field, func(t *testing.T) {
+				dir := t.TempDir()
+				s, err := openStore(storeOptions{Dir: dir, Backend: backend})
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer s.Close()
+				if err := s.SaveProjects([]projectEntry{{ID: "a", Name: "A"}, {ID: "b", Name: "B"}}); err != nil {
+					t.Fatal(err)
+				}
+				if err := s.AddRecord(original); err != nil {
+					t.Fatal(err)
+				}
+				m, err := newModel(s)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				m.checkpoint("edit " + field)
+				edited := m.records[0]
+				edit(&edited)
+				m.records[0] = edited
+				if err := s.UpdateRecord(edited); err != nil {
+					t.Fatal(err)
+				}
+
+				m.undo()
+				if m.saveError != "" {
+					t.Fatalf("undo: %s", m.saveError)
+				}
+				if got, want := recordJSON(t, storedRecord(t, dir, backend, "r1")), recordJSON(t, original); got != want {
+					t.Errorf("after undo stored %s, want %s", got, want)
+				}
+				m.redo()
+				if m.saveError != "" {
+					t.Fatalf("redo: %s", m.saveError)
+				}
+				if got, want := recordJSON(t, storedRecord(t, dir, backend, "r1")), recordJSON(t, edited); got != want {
+					t.Errorf("after redo stored %s, want %s", got, want)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// icsTime formats t as an iCalendar UTC date-time
+func icsTime(t time.Time) string {
+	return t.UTC().Format("20060102T150405Z")
+}
+
+// icsEscape escapes text property values (RFC 5545 section 3.3.11)
+func icsEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\n", `\n`).Replace(s)
+}
+
+// icsLine writes a content line, folding it at 75 octets without splitting
+// UTF-8 sequences
+func icsLine(w *bufio.Writer, line string) {
+	for len(line) > 75 {
+		cut := 75
+		for cut > 0 && line[cut]&0xC0 == 0x80 {
+			cut--
+		}
+		w.WriteString(line[:cut] + "\r\n")
+		line = " " + line[cut:]
+	}
+	w.WriteString(line + "\r\n")
+}
+
+// writeICS writes each record as a past VEVENT. UIDs come from record IDs so
+// importing the file again updates events instead of duplicating them.
+func writeICS(out io.Writer, records []record, names map[string]string) error {
+	w := bufio.NewWriter(out)
+	stamp := icsTime(time.Now())
+	icsLine(w, "BEGIN:VCALENDAR")
+	icsLine(w, "VERSION:2.0")
+	icsLine(w, "PRODID:-//fishtime//fishtime//EN")
+	icsLine(w, "CALSCALE:GREGORIAN")
+	for _, r := range sortedByStart(records) {
+		icsLine(w, "BEGIN:VEVENT")
+		icsLine(w, "UID:"+r.ID+"@fishtime")
+		icsLine(w, "DTSTAMP:"+stamp)
+		icsLine(w, "DTSTART:"+icsTime(r.StartTime))
+		icsLine(w, "DTEND:"+icsTime(recordEnd(r)))
+		icsLine(w, "SUMMARY:"+icsEscape(names[r.ProjectID]))
+		desc := fmt.Sprintf("Tracked with fishtime (%s)", formatDuration(r.Duration))
+		if r.Note != "" {
+			desc = r.Note + "\n\n" + desc
+		}
+		icsLine(w, "DESCRIPTION:"+icsEscape(desc))
+		if tags := recordTags(r); len(tags) > 0 {
+			escaped := make([]string, len(tags))
+			for i, t := range tags {
+				escaped[i] = icsEscape(t)
+			}
+			icsLine(w, "CATEGORIES:"+strings.Join(escaped, ","))
+		}
+		icsLine(w, "TRANSP:TRANSPARENT")
+		icsLine(w, "END:VEVENT")
+	}
+	icsLine(w, "END:VCALENDAR")
+	return w.Flush()
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bufio"
+	"strings"
+	"testing"
+	"unicode/utf8"
+)
+
+func TestICSLine(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		line string
+	}{
+		{"short", "SUMMARY:Acme"},
+		{"exactly 75", "SUMMARY:" + strings.Repeat("a", 67)},
+		{"ascii", "DESCRIPTION:" + strings.Repeat("abcdefghij", 20)},
+		// The 3-byte "€" straddles octet 75 unless the fold moves back
+		{"utf-8", "DESCRIPTION:" + strings.Repeat("a", 62) + strings.Repeat("€", 30)},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var b strings.Builder
+			w := bufio.NewWriter(&b)
+			icsLine(w, tt.line)
+			w.Flush()
+
+			out := b.String()
+			if !strings.HasSuffix(out, "\r\n") {
+				t.Fatalf("%q does not end in CRLF", out)
+			}
+			lines := strings.Split(strings.TrimSuffix(out, "\r\n"), "\r\n")
+			var unfolded strings.Builder
+			for i, l := range lines {
+				if len(l) > 75 {
+					t.Errorf("line %d has %d octets, more than 75", i, len(l))
+				}
+				if !utf8.ValidString(l) {
+					t.Errorf("line %d splits a UTF-8 sequence: %q", i, l)
+				}
+				if i > 0 {
+					if !strings.HasPrefix(l, " ") {
+						t.Errorf("continuation line %d does not start with a space", i)
+					}
+					l = l[1:]
+				}
+				unfolded.WriteString(l)
+			}
+			if unfolded.String() != tt.line {
+				t.Errorf("unfolds to %q, want %q", unfolded.String(), tt.line)
+			}
+			if len(tt.line) <= 75 && len(lines) != 1 {
+				t.Errorf("folded a %d octet line", len(tt.line))
+			}
+		})
+	}
+}
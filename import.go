@@ -0,0 +1,321 @@
+package main
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// importedEntry is a closed interval read from another tracker
+type importedEntry struct {
+	Project string
+	Start   time.Time
+	End     time.Time
+	Note    string
+	Tags    []string
+}
+
+// importers maps --from values to the parser for that tracker's files
+var importers = map[string]func(r io.Reader) ([]importedEntry, error){
+	"timewarrior": parseTimewarrior,
+	"watson":      parseWatson,
+	"toggl":       parseToggl,
+}
+
+// parseTimewarrior reads a Timewarrior data file (data/YYYY-MM.data). The
+// first tag becomes the project, the other tags stay tags and the annotation
+// becomes the note. Open intervals are still running and are skipped.
+func parseTimewarrior(r io.Reader) ([]importedEntry, error) {
+	var entries []importedEntry
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" {
+			continue
+		}
+		interval, tags, _ := strings.Cut(line, " # ")
+		fields := strings.Fields(interval)
+		if len(fields) == 2 && fields[0] == "inc" {
+			continue
+		}
+		if len(fields) != 4 || fields[0] != "inc" || fields[2] != "-" {
+			return nil, fmt.Errorf("line %d: not a Timewarrior interval", n)
+		}
+		start, err := time.Parse("20060102T150405Z", fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid start %q", n, fields[1])
+		}
+		end, err := time.Parse("20060102T150405Z", fields[3])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid end %q", n, fields[3])
+		}
+		// Annotations follow the tags after a second " # "
+		tags, annotation, _ := strings.Cut(tags, " # ")
+		project := "Timewarrior"
+		var rest []string
+		if t := timewarriorTags(tags); len(t) > 0 {
+			project, rest = t[0], t[1:]
+		}
+		var note string
+		if a := timewarriorTags(annotation); len(a) > 0 {
+			note = strings.Join(a, " ")
+		}
+		entries = append(entries, importedEntry{project, start.Local(), end.Local(), note, importTags(rest)})
+	}
+	return entries, sc.Err()
+}
+
+// timewarriorTags splits a tag list where tags with spaces are quoted and
+// quotes inside them are escaped with a backslash
+func timewarriorTags(s string) []string {
+	var tags []string
+	for s = strings.TrimSpace(s); s != ""; s = strings.TrimSpace(s) {
+		if s[0] == '"' {
+			var tag strings.Builder
+			i := 1
+			for ; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) {
+					i++
+				}
+				tag.WriteByte(s[i])
+			}
+			tags = append(tags, tag.String())
+			s = s[min(i+1, len(s)):]
+			continue
+		}
+		tag, rest, _ := strings.Cut(s, " ")
+		tags = append(tags, tag)
+		s = rest
+	}
+	return tags
+}
+
+// parseWatson reads Watson's frames file, a JSON array of
+// [start, stop, project, id, tags, updated_at] with Unix timestamps
+func parseWatson(r io.Reader) ([]importedEntry, error) {
+	var frames [][]json.RawMessage
+	if err := json.NewDecoder(r).Decode(&frames); err != nil {
+		return nil, fmt.Errorf("not a Watson frames file: %w", err)
+	}
+	entries := make([]importedEntry, 0, len(frames))
+	for i, f := range frames {
+		var start, stop int64
+		var project string
+		if len(f) < 3 || json.Unmarshal(f[0], &start) != nil || json.Unmarshal(f[1], &stop) != nil ||
+			json.Unmarshal(f[2], &project) != nil {
+			return nil, fmt.Errorf("frame %d: expected [start, stop, project, ...]", i+1)
+		}
+		var tags []string
+		if len(f) > 4 {
+			json.Unmarshal(f[4], &tags)
+		}
+		entries = append(entries, importedEntry{project, time.Unix(start, 0), time.Unix(stop, 0), "", importTags(tags)})
+	}
+	return entries, nil
+}
+
+// parseToggl reads a Toggl Track detailed CSV export. Columns are found by
+// header name since Toggl adds and reorders them between versions. Client
+// and Task columns, when present, place entries at "Client/Project/Task".
+func parseToggl(r io.Reader) ([]importedEntry, error) {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	header, err := cr.Read()
+	if err != nil {
+		return nil, fmt.Errorf("not a Toggl CSV export: %w", err)
+	}
+	col := make(map[string]int)
+	for i, h := range header {
+		col[strings.TrimPrefix(strings.TrimSpace(h), "\ufeff")] = i
+	}
+	for _, name := range []string{"Project", "Start date", "Start time", "End date", "End time"} {
+		if _, ok := col[name]; !ok {
+			return nil, fmt.Errorf("not a Toggl CSV export: missing %q column", name)
+		}
+	}
+	field := func(row []string, name string) string {
+		if i, ok := col[name]; ok && i < len(row) {
+			return strings.TrimSpace(row[i])
+		}
+		return ""
+	}
+
+	var entries []importedEntry
+	for n := 2; ; n++ {
+		row, err := cr.Read()
+		if err == io.EOF {
+			return entries, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		start, err := time.ParseInLocation("2006-01-02 15:04:05", field(row, "Start date")+" "+field(row, "Start time"), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid start", n)
+		}
+		end, err := time.ParseInLocation("2006-01-02 15:04:05", field(row, "End date")+" "+field(row, "End time"), time.Local)
+		if err != nil {
+			return nil, fmt.Errorf("row %d: invalid end", n)
+		}
+		project := field(row, "Project")
+		if project == "" {
+			project = "Toggl"
+		}
+		if client := field(row, "Client"); client != "" {
+			project = client + pathSeparator + project
+		}
+		if task := field(row, "Task"); task != "" {
+			project += pathSeparator + task
+		}
+		entries = append(entries, importedEntry{project, start, end, field(row, "Description"), importTags(strings.Split(field(row, "Tags"), ","))})
+	}
+}
+
+// importTags normalizes tags from another tracker, which may contain spaces
+func importTags(tags []string) []string {
+	for i, t := range tags {
+		tags[i] = strings.Join(strings.Fields(t), "-")
+	}
+	return parseTags(strings.Join(tags, ","))
+}
+
+// overlaps reports whether two records share any time
+func overlaps(a, b record) bool {
+	return a.StartTime.Before(recordEnd(b)) && b.StartTime.Before(recordEnd(a))
+}
+
+// fishtime import --from timewarrior|watson|toggl [--dry-run] FILE...
+func cmdImport(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	from := fs.String("from", "", "tracker the files come from: timewarrior, watson or toggl")
+	dryRun := fs.Bool("dry-run", false, "report what would be imported without saving")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	parse, ok := importers[*from]
+	if !ok {
+		return fmt.Errorf("invalid --from %q (use timewarrior, watson or toggl)", *from)
+	}
+	if fs.NArg() == 0 {
+		return errors.New("missing file to import")
+	}
+
+	var entries []importedEntry
+	for _, path := range fs.Args() {
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		e, err := parse(f)
+		f.Close()
+		if err != nil {
+			return fmt.Errorf("%s: %w", path, err)
+		}
+		entries = append(entries, e...)
+	}
+
+	projects, err := store.Projects()
+	if err != nil {
+		return err
+	}
+	// known holds existing and already accepted records for duplicate and
+	// overlap checks
+	known, err := store.Records()
+	if err != nil {
+		return err
+	}
+
+	var newProjects []string
+	var added []record
+	var duplicates, overlapping, empty, tooDeep int
+	for _, e := range entries {
+		if !e.End.After(e.Start) {
+			empty++
+			continue
+		}
+		name := strings.TrimSpace(e.Project)
+		if strings.Trim(name, pathSeparator+" ") == "" {
+			name = "Imported"
+		}
+		// Paths such as "Acme/Website" create missing levels of the tree
+		var id string
+		if p, err := lookupProject(projects, name); err == nil {
+			id = p.ID
+		} else {
+			var created []string
+			if id, projects, created, err = ensureProjectPath(projects, name); err != nil {
+				fmt.Fprintf(out, "too deep: %s %s (skipped)\n", name, e.Start.Local().Format("2006-01-02 15:04"))
+				tooDeep++
+				continue
+			}
+			newProjects = append(newProjects, created...)
+		}
+		r := record{
+			ID:        newID(),
+			ProjectID: id,
+			Duration:  int64(e.End.Sub(e.Start).Seconds()),
+			StartTime: e.Start,
+			Note:      strings.TrimSpace(e.Note),
+			Tags:      e.Tags,
+		}
+
+		desc := fmt.Sprintf("%s %s %s", name, r.StartTime.Local().Format("2006-01-02 15:04"), formatDuration(r.Duration))
+		duplicate := false
+		var clash string
+		for _, o := range known {
+			if o.ProjectID == r.ProjectID && o.StartTime.Equal(r.StartTime) && o.Duration == r.Duration {
+				duplicate = true
+				break
+			}
+			if clash == "" && overlaps(o, r) {
+				clash = projectPaths(projects)[o.ProjectID] + " at " + o.StartTime.Local().Format("2006-01-02 15:04")
+			}
+		}
+		if duplicate {
+			fmt.Fprintf(out, "duplicate: %s (skipped)\n", desc)
+			duplicates++
+			continue
+		}
+		if clash != "" {
+			fmt.Fprintf(out, "overlap: %s overlaps %s\n", desc, clash)
+			overlapping++
+		}
+		added = append(added, r)
+		known = append(known, r)
+	}
+
+	verb := "Imported"
+	if *dryRun {
+		verb = "Would import"
+	} else if len(added) > 0 {
+		// Projects first so no record points at a missing project
+		if len(newProjects) > 0 {
+			if err := store.SaveProjects(projects); err != nil {
+				return err
+			}
+		}
+		if err := store.AddRecords(added); err != nil {
+			return err
+		}
+	}
+	fmt.Fprintf(out, "%s %d records", verb, len(added))
+	if len(newProjects) > 0 {
+		fmt.Fprintf(out, " and %d new projects (%s)", len(newProjects), strings.Join(newProjects, ", "))
+	}
+	fmt.Fprintf(out, "; %d duplicates skipped, %d overlaps", duplicates, overlapping)
+	if empty > 0 {
+		fmt.Fprintf(out, ", %d empty entries skipped", empty)
+	}
+	if tooDeep > 0 {
+		fmt.Fprintf(out, ", %d entries nested deeper than client/project/task skipped", tooDeep)
+	}
+	fmt.Fprintln(out)
+	return nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"slices"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseTimewarrior(t *testing.T) {
+	data := `inc 20240301T090000Z - 20240301T103000Z # Acme "code review" urgent # "fixed \"login\" bug"
+inc 20240302T080000Z - 20240302T081500Z
+inc 20240303T080000Z # still running
+`
+	entries, err := parseTimewarrior(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2 (open intervals are skipped)", len(entries))
+	}
+	e := entries[0]
+	if e.Project != "Acme" {
+		t.Errorf("project %q, want Acme", e.Project)
+	}
+	if want := []string{"code-review", "urgent"}; !slices.Equal(e.Tags, want) {
+		t.Errorf("tags %q, want %q", e.Tags, want)
+	}
+	if want := `fixed "login" bug`; e.Note != want {
+		t.Errorf("note %q, want %q", e.Note, want)
+	}
+	if !e.Start.Equal(time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)) || e.End.Sub(e.Start) != 90*time.Minute {
+		t.Errorf("interval %v - %v, want 09:00Z for 1h30m", e.Start, e.End)
+	}
+	if entries[1].Project != "Timewarrior" {
+		t.Errorf("untagged interval got project %q, want Timewarrior", entries[1].Project)
+	}
+
+	if _, err := parseTimewarrior(strings.NewReader("not an interval\n")); err == nil {
+		t.Error("invalid line parsed without error")
+	}
+}
+
+func TestTimewarriorTags(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"", nil},
+		{"a b", []string{"a", "b"}},
+		{`"two words" b`, []string{"two words", "b"}},
+		{`a "say \"hi\""`, []string{"a", `say "hi"`}},
+	} {
+		if got := timewarriorTags(tt.in); !slices.Equal(got, tt.want) {
+			t.Errorf("timewarriorTags(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestParseWatson(t *testing.T) {
+	data := `[[1709283600, 1709287200, "Acme", "abc", ["Design", "big ideas"], 1709287200],
+		[1709290800, 1709292600, "Other", "def"]]`
+	entries, err := parseWatson(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	if e := entries[0]; e.Project != "Acme" || e.End.Sub(e.Start) != time.Hour || !slices.Equal(e.Tags, []string{"big-ideas", "design"}) {
+		t.Errorf("first frame = %+v, want Acme for 1h tagged big-ideas, design", e)
+	}
+	if e := entries[1]; e.Project != "Other" || len(e.Tags) != 0 {
+		t.Errorf("second frame = %+v, want Other without tags", e)
+	}
+
+	if _, err := parseWatson(strings.NewReader(`[[1709283600]]`)); err == nil {
+		t.Error("short frame parsed without error")
+	}
+}
+
+func TestParseToggl(t *testing.T) {
+	data := "\ufeffUser,Client,Project,Task,Description,Start date,Start time,End date,End time,Tags\n" +
+		"me,Acme,Website,Design,\"Header, footer\",2024-03-01,09:00:00,2024-03-01,10:30:00,\"Urgent, Call\"\n" +
+		"me,,,,,2024-03-02,08:00:00,2024-03-02,08:15:00,\n"
+	entries, err := parseToggl(strings.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(entries))
+	}
+	e := entries[0]
+	if e.Project != "Acme/Website/Design" {
+		t.Errorf("project %q, want Acme/Website/Design", e.Project)
+	}
+	if e.Note != "Header, footer" {
+		t.Errorf("note %q, want %q", e.Note, "Header, footer")
+	}
+	if want := []string{"call", "urgent"}; !slices.Equal(e.Tags, want) {
+		t.Errorf("tags %q, want %q", e.Tags, want)
+	}
+	if want := time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local); !e.Start.Equal(want) || e.End.Sub(e.Start) != 90*time.Minute {
+		t.Errorf("interval %v - %v, want %v for 1h30m", e.Start, e.End, want)
+	}
+	if entries[1].Project != "Toggl" {
+		t.Errorf("entry without project got %q, want Toggl", entries[1].Project)
+	}
+
+	if _, err := parseToggl(strings.NewReader("User,Description\nme,x\n")); err == nil {
+		t.Error("CSV without Toggl columns parsed without error")
+	}
+}
@@ -0,0 +1,377 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// invoiceLine bills one project's records of one day
+type invoiceLine struct {
+	Day         time.Time
+	Description string // Notes of the day's records
+	Seconds     int64  // Billed time, rounded per record
+	Rate        float64
+	Amount      float64
+}
+
+// invoiceGroup holds a project's lines and subtotal
+type invoiceGroup struct {
+	Project string // Path below the client, the client's own name for its records
+	Lines   []invoiceLine
+	Seconds int64
+	Amount  float64
+}
+
+// invoice is everything an invoice document shows
+type invoice struct {
+	Number   string
+	Draft    bool // Written by --dry-run, nothing was marked
+	Client   string
+	Issued   time.Time
+	From, To time.Time // Days billed, both inclusive
+	Currency string
+	Groups   []invoiceGroup
+	Seconds  int64
+	Subtotal float64
+	TaxRate  float64 // Percent
+	Tax      float64
+	Total    float64
+}
+
+// invoiceWriters maps invoice format names to the function writing them
+var invoiceWriters = map[string]func(w io.Writer, inv invoice) error{
+	"html": writeInvoiceHTML,
+	"md":   writeInvoiceMarkdown,
+}
+
+// formatInvoiceNumber writes a number of the invoice sequence
+func formatInvoiceNumber(n int) string {
+	return fmt.Sprintf("%04d", n)
+}
+
+// roundCents rounds an amount to two decimals so lines add up to the totals
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
+
+// buildInvoice bills records, which must all be billable and below client,
+// grouped by project and day. All of them must bill in the same currency.
+func buildInvoice(records []record, projects []projectEntry, client projectEntry, taxRate float64) (invoice, error) {
+	paths := projectPaths(projects)
+	clientPath := paths[client.ID]
+	inv := invoice{Client: clientPath, Issued: time.Now(), TaxRate: taxRate}
+	groups := make(map[string]*invoiceGroup)
+	var order []string
+	currencies := make(map[string]bool)
+	rates := projectRates(projects)
+	// notes holds each line's notes so a note is listed once per line
+	type lineKey struct {
+		group string
+		line  int
+	}
+	notes := make(map[lineKey]map[string]bool)
+	for _, r := range sortedByStart(records) {
+		rate, currency := rates[r.ProjectID].rate, rates[r.ProjectID].currency
+		if rate == 0 {
+			return invoice{}, fmt.Errorf("%s has no rate; set one with fishtime rate", paths[r.ProjectID])
+		}
+		currencies[currency] = true
+		inv.Currency = currency
+
+		name := strings.TrimPrefix(strings.TrimPrefix(paths[r.ProjectID], clientPath), pathSeparator)
+		if name == "" {
+			name = client.Name
+		}
+		g, ok := groups[name]
+		if !ok {
+			g = &invoiceGroup{Project: name}
+			groups[name] = g
+			order = append(order, name)
+		}
+		start := r.StartTime.Local()
+		day := time.Date(start.Year(), start.Month(), start.Day(), 0, 0, 0, 0, time.Local)
+		if n := len(g.Lines); n == 0 || !g.Lines[n-1].Day.Equal(day) || g.Lines[n-1].Rate != rate {
+			g.Lines = append(g.Lines, invoiceLine{Day: day, Rate: rate})
+		}
+		key := lineKey{name, len(g.Lines) - 1}
+		line := &g.Lines[key.line]
+		line.Seconds += billedSeconds(r.Duration)
+		if r.Note != "" && !notes[key][r.Note] {
+			if notes[key] == nil {
+				notes[key] = make(map[string]bool)
+			}
+			notes[key][r.Note] = true
+			if line.Description != "" {
+				line.Description += "; "
+			}
+			line.Description += r.Note
+		}
+
+		if inv.From.IsZero() || day.Before(inv.From) {
+			inv.From = day
+		}
+		if day.After(inv.To) {
+			inv.To = day
+		}
+	}
+	if len(currencies) > 1 {
+		return invoice{}, errors.New("the records bill in several currencies; invoice each project separately")
+	}
+
+	sort.Strings(order)
+	for _, name := range order {
+		g := groups[name]
+		for i := range g.Lines {
+			g.Lines[i].Amount = roundCents(float64(g.Lines[i].Seconds) / 3600 * g.Lines[i].Rate)
+			g.Seconds += g.Lines[i].Seconds
+			g.Amount += g.Lines[i].Amount
+		}
+		inv.Groups = append(inv.Groups, *g)
+		inv.Seconds += g.Seconds
+		inv.Subtotal += g.Amount
+	}
+	inv.Subtotal = roundCents(inv.Subtotal)
+	inv.Tax = roundCents(inv.Subtotal * taxRate / 100)
+	inv.Total = inv.Subtotal + inv.Tax
+	return inv, nil
+}
+
+// invoiceHours writes billed time as decimal hours
+func invoiceHours(seconds int64) string {
+	return fmt.Sprintf("%.2f", float64(seconds)/3600)
+}
+
+// formatTaxRate writes a tax percentage without trailing zeros
+func formatTaxRate(rate float64) string {
+	return fmt.Sprintf("%g%%", rate)
+}
+
+// writeInvoiceMarkdown writes the invoice as Markdown tables
+func writeInvoiceMarkdown(w io.Writer, inv invoice) error {
+	var b strings.Builder
+	title := "Invoice " + inv.Number
+	if inv.Draft {
+		title += " (draft)"
+	}
+	fmt.Fprintf(&b, "# %s\n\n", title)
+	fmt.Fprintf(&b, "- **Client:** %s\n", markdownEscape(inv.Client))
+	fmt.Fprintf(&b, "- **Issued:** %s\n", inv.Issued.Format("2006-01-02"))
+	fmt.Fprintf(&b, "- **Period:** %s to %s\n\n", inv.From.Format("2006-01-02"), inv.To.Format("2006-01-02"))
+	for _, g := range inv.Groups {
+		fmt.Fprintf(&b, "## %s\n\n", markdownEscape(g.Project))
+		b.WriteString("| Date | Description | Hours | Rate | Amount |\n")
+		b.WriteString("|------|-------------|------:|-----:|-------:|\n")
+		for _, l := range g.Lines {
+			fmt.Fprintf(&b, "| %s | %s | %s | %s | %s |\n", l.Day.Format("2006-01-02"), markdownEscape(l.Description),
+				invoiceHours(l.Seconds), formatMoney(l.Rate, inv.Currency), formatMoney(l.Amount, inv.Currency))
+		}
+		fmt.Fprintf(&b, "| | **Subtotal** | **%s** | | **%s** |\n\n", invoiceHours(g.Seconds), formatMoney(g.Amount, inv.Currency))
+	}
+	b.WriteString("| | |\n|---|---:|\n")
+	fmt.Fprintf(&b, "| Subtotal (%s hours) | %s |\n", invoiceHours(inv.Seconds), formatMoney(inv.Subtotal, inv.Currency))
+	if inv.TaxRate > 0 {
+		fmt.Fprintf(&b, "| Tax (%s) | %s |\n", formatTaxRate(inv.TaxRate), formatMoney(inv.Tax, inv.Currency))
+	}
+	fmt.Fprintf(&b, "| **Total** | **%s** |\n", formatMoney(inv.Total, inv.Currency))
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// invoiceHTML is a self-contained page with print styles
+var invoiceHTML = template.Must(template.New("invoice").Funcs(template.FuncMap{
+	"date":  func(t time.Time) string { return t.Format("2006-01-02") },
+	"hours": invoiceHours,
+	"money": formatMoney,
+	"tax":   formatTaxRate,
+}).Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<title>Invoice {{.Number}}</title>
+<style>
+body { font-family: system-ui, sans-serif; color: #222; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; }
+h1 { margin-bottom: 0.25rem; }
+dl { display: grid; grid-template-columns: max-content auto; gap: 0.25rem 1rem; }
+dt { font-weight: bold; }
+dd { margin: 0; }
+table { width: 100%; border-collapse: collapse; margin: 1rem 0; }
+th, td { padding: 0.3rem 0.5rem; border-bottom: 1px solid #ddd; text-align: left; vertical-align: top; }
+.num { text-align: right; white-space: nowrap; }
+.sub td { font-weight: bold; border-bottom: 2px solid #999; }
+.totals { width: auto; margin-left: auto; }
+.total td { font-weight: bold; font-size: 1.2em; border-bottom: none; }
+.draft { color: #b00; }
+@media print { body { margin: 0; max-width: none; } h2 { break-after: avoid; } tr { break-inside: avoid; } }
+</style>
+</head>
+<body>
+<h1>Invoice {{.Number}}{{if .Draft}} <span class="draft">(draft)</span>{{end}}</h1>
+<dl>
+<dt>Client</dt><dd>{{.Client}}</dd>
+<dt>Issued</dt><dd>{{date .Issued}}</dd>
+<dt>Period</dt><dd>{{date .From}} to {{date .To}}</dd>
+</dl>
+{{range .Groups}}<h2>{{.Project}}</h2>
+<table>
+<tr><th>Date</th><th>Description</th><th class="num">Hours</th><th class="num">Rate</th><th class="num">Amount</th></tr>
+{{range .Lines}}<tr><td>{{date .Day}}</td><td>{{.Description}}</td><td class="num">{{hours .Seconds}}</td><td class="num">{{money .Rate $.Currency}}</td><td class="num">{{money .Amount $.Currency}}</td></tr>
+{{end}}<tr class="sub"><td></td><td>Subtotal</td><td class="num">{{hours .Seconds}}</td><td></td><td class="num">{{money .Amount $.Currency}}</td></tr>
+</table>
+{{end}}<table class="totals">
+<tr><td>Subtotal ({{hours .Seconds}} hours)</td><td class="num">{{money .Subtotal .Currency}}</td></tr>
+{{if gt .TaxRate 0.0}}<tr><td>Tax ({{tax .TaxRate}})</td><td class="num">{{money .Tax .Currency}}</td></tr>
+{{end}}<tr class="total"><td>Total</td><td class="num">{{money .Total .Currency}}</td></tr>
+</table>
+</body>
+</html>
+`))
+
+// writeInvoiceHTML writes the invoice as a printable HTML page
+func writeInvoiceHTML(w io.Writer, inv invoice) error {
+	return invoiceHTML.Execute(w, inv)
+}
+
+// fishtime invoice --client NAME [--from DATE] [--to DATE] [--tax PERCENT] [--format html|md] [-o FILE] [--dry-run]
+// fishtime invoice --void NUMBER
+func cmdInvoice(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("invoice", flag.ContinueOnError)
+	clientName := fs.String("client", "", "client or project to bill, with everything below it")
+	from := fs.String("from", "", "first day to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day to include (YYYY-MM-DD)")
+	taxRate := fs.Float64("tax", 0, "tax rate in percent added to the subtotal")
+	format := fs.String("format", "", "output format: html or md (default from the -o extension, else md)")
+	output := fs.String("o", "", "write to this file instead of standard output")
+	dryRun := fs.Bool("dry-run", false, "write a draft without numbering it or marking records as invoiced")
+	void := fs.String("void", "", "clear the invoiced mark of the records on this invoice number")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if *void != "" {
+		return voidInvoice(store, *void, out)
+	}
+	if *clientName == "" {
+		return errors.New("missing --client")
+	}
+	if *taxRate < 0 {
+		return fmt.Errorf("invalid --tax %g", *taxRate)
+	}
+	if *format == "" {
+		*format = "md"
+		if ext := strings.TrimPrefix(filepath.Ext(*output), "."); ext == "html" || ext == "htm" {
+			*format = "html"
+		}
+	}
+	write, ok := invoiceWriters[*format]
+	if !ok {
+		return fmt.Errorf("unknown invoice format %q (use html or md)", *format)
+	}
+
+	f, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	projects, err := store.Projects()
+	if err != nil {
+		return err
+	}
+	client, err := lookupProject(projects, *clientName)
+	if err != nil {
+		return err
+	}
+	f.ProjectIDs = withDescendants(projects, map[string]bool{client.ID: true})
+	records, err := store.Records()
+	if err != nil {
+		return err
+	}
+	// Records billed before or not billable stay off the invoice
+	var billable []record
+	for _, r := range filterRecords(records, projects, f) {
+		if !r.NonBillable && r.Invoice == "" {
+			billable = append(billable, r)
+		}
+	}
+	if len(billable) == 0 {
+		return fmt.Errorf("no billable records for %s in range that were not invoiced yet", projectPaths(projects)[client.ID])
+	}
+
+	inv, err := buildInvoice(billable, projects, client, *taxRate)
+	if err != nil {
+		return err
+	}
+	last, err := store.LastInvoice()
+	if err != nil {
+		return err
+	}
+	inv.Number = formatInvoiceNumber(last + 1)
+	inv.Draft = *dryRun
+	// The asked for range covers days without records too
+	if !f.From.IsZero() {
+		inv.From = f.From
+	}
+	if !f.To.IsZero() {
+		inv.To = f.To.AddDate(0, 0, -1)
+	}
+
+	var buf bytes.Buffer
+	if err := write(&buf, inv); err != nil {
+		return err
+	}
+	if *output == "" {
+		if _, err := out.Write(buf.Bytes()); err != nil {
+			return err
+		}
+	} else if err := atomicWriteFile(*output, buf.Bytes(), 0644); err != nil {
+		return err
+	}
+	if *dryRun {
+		return nil
+	}
+
+	// The number and the marks are saved together, so a failure leaves
+	// neither behind
+	for i := range billable {
+		billable[i].Invoice = inv.Number
+	}
+	if err := store.SaveInvoice(last+1, billable); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Invoice %s: %d records, %s\n", inv.Number, len(billable), formatMoney(inv.Total, inv.Currency))
+	return nil
+}
+
+// voidInvoice clears the invoice mark from the records billed on number so
+// they can be invoiced again. The number is not reused.
+func voidInvoice(store Store, number string, out io.Writer) error {
+	records, err := store.Records()
+	if err != nil {
+		return err
+	}
+	var voided []record
+	for _, r := range records {
+		if r.Invoice == number {
+			r.Invoice = ""
+			voided = append(voided, r)
+		}
+	}
+	if len(voided) == 0 {
+		return fmt.Errorf("no records are on invoice %q", number)
+	}
+	if err := store.UpdateRecords(voided); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Voided invoice %s, %d records can be invoiced again\n", number, len(voided))
+	return nil
+}
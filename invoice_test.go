@@ -0,0 +1,120 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestBuildInvoice(t *testing.T) {
+	defer func(i int64) { billingIncrement = i }(billingIncrement)
+	billingIncrement = 15 * 60
+
+	projects := []projectEntry{
+		{ID: "acme", Name: "Acme", Rate: 100, Currency: "EUR"},
+		{ID: "web", Name: "Website", ParentID: "acme"},
+		{ID: "design", Name: "Design", ParentID: "web", Rate: 120},
+	}
+	at := func(d, h, m int) time.Time { return time.Date(2024, 3, d, h, m, 0, 0, time.Local) }
+	records := []record{
+		{ID: "1", ProjectID: "web", Duration: 3600, StartTime: at(1, 9, 0), Note: "QA review"},
+		// A note contained in another one is still listed, a repeated one once
+		{ID: "2", ProjectID: "web", Duration: 20 * 60, StartTime: at(1, 11, 0), Note: "QA"},
+		{ID: "3", ProjectID: "web", Duration: 10 * 60, StartTime: at(1, 14, 0), Note: "QA"},
+		{ID: "4", ProjectID: "acme", Duration: 30 * 60, StartTime: at(1, 16, 0), Note: "Call"},
+		{ID: "5", ProjectID: "design", Duration: 45 * 60, StartTime: at(2, 10, 0)},
+	}
+	inv, err := buildInvoice(records, projects, projects[0], 19)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	type line struct {
+		description string
+		seconds     int64
+		amount      float64
+	}
+	want := map[string][]line{
+		"Acme":           {{"Call", 30 * 60, 50}},
+		"Website":        {{"QA review; QA", 105 * 60, 175}}, // 20m and 10m bill as 30m and 15m
+		"Website/Design": {{"", 45 * 60, 90}},
+	}
+	if len(inv.Groups) != len(want) {
+		t.Fatalf("got %d groups, want %d", len(inv.Groups), len(want))
+	}
+	for i, name := range []string{"Acme", "Website", "Website/Design"} {
+		g := inv.Groups[i]
+		if g.Project != name {
+			t.Errorf("group %d is %q, want %q", i, g.Project, name)
+			continue
+		}
+		if len(g.Lines) != len(want[name]) {
+			t.Errorf("%s has %d lines, want %d", name, len(g.Lines), len(want[name]))
+			continue
+		}
+		for j, w := range want[name] {
+			l := g.Lines[j]
+			if l.Description != w.description || l.Seconds != w.seconds || l.Amount != w.amount {
+				t.Errorf("%s line %d = %q %ds %.2f, want %q %ds %.2f", name, j, l.Description, l.Seconds, l.Amount,
+					w.description, w.seconds, w.amount)
+			}
+		}
+	}
+	if inv.Currency != "EUR" || inv.Subtotal != 315 || inv.Tax != 59.85 || inv.Total != 374.85 {
+		t.Errorf("totals %.2f + %.2f = %.2f %s, want 315.00 + 59.85 = 374.85 EUR", inv.Subtotal, inv.Tax, inv.Total, inv.Currency)
+	}
+	if !inv.From.Equal(at(1, 0, 0)) || !inv.To.Equal(at(2, 0, 0)) {
+		t.Errorf("billed days %s - %s, want 2024-03-01 - 2024-03-02", inv.From, inv.To)
+	}
+}
+
+func TestBuildInvoiceTaxRounding(t *testing.T) {
+	defer func(i int64) { billingIncrement = i }(billingIncrement)
+	billingIncrement = 0
+
+	projects := []projectEntry{{ID: "acme", Name: "Acme", Rate: 33.33}}
+	records := []record{{ID: "1", ProjectID: "acme", Duration: 3600, StartTime: time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local)}}
+	inv, err := buildInvoice(records, projects, projects[0], 7.5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 7.5% of 33.33 is 2.49975
+	if inv.Subtotal != 33.33 || inv.Tax != 2.5 || inv.Total != 35.83 {
+		t.Errorf("totals %v + %v = %v, want 33.33 + 2.5 = 35.83", inv.Subtotal, inv.Tax, inv.Total)
+	}
+}
+
+func TestBuildInvoiceErrors(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local)
+	for _, tt := range []struct {
+		name     string
+		projects []projectEntry
+	}{
+		{"no rate", []projectEntry{{ID: "acme", Name: "Acme"}, {ID: "web", Name: "Website", ParentID: "acme"}}},
+		{"two currencies", []projectEntry{
+			{ID: "acme", Name: "Acme", Rate: 100, Currency: "EUR"},
+			{ID: "web", Name: "Website", ParentID: "acme", Currency: "USD"},
+		}},
+	} {
+		records := []record{
+			{ID: "1", ProjectID: "acme", Duration: 3600, StartTime: start},
+			{ID: "2", ProjectID: "web", Duration: 3600, StartTime: start.Add(time.Hour)},
+		}
+		if _, err := buildInvoice(records, tt.projects, tt.projects[0], 0); err == nil {
+			t.Errorf("%s: built an invoice without error", tt.name)
+		}
+	}
+}
+
+func TestRoundCents(t *testing.T) {
+	for _, tt := range []struct{ in, want float64 }{
+		{0, 0},
+		{12.344, 12.34},
+		{12.345001, 12.35},
+		{2.49975, 2.5},
+		{0.125, 0.13},
+	} {
+		if got := roundCents(tt.in); got != tt.want {
+			t.Errorf("roundCents(%v) = %v, want %v", tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,281 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"time"
+)
+
+// jsonStore keeps the whole app state in a single JSON file, rewriting it on
+// every change
+type jsonStore struct {
+	path     string
+	state    appState
+	backups  int       // Number of backups to keep
+	backedUp bool      // Whether this session already made its backup
+	modTime  time.Time // Modification time of the file as last read or written
+	loads    int64     // Times the file was read, so changes by others
+	readOnly bool      // Opened only to copy the data elsewhere, never written
+}
+
+// openJSONStore opens the data file at path, keeping up to backups
+// timestamped copies of it
+func openJSONStore(path string, backups int) (*jsonStore, error) {
+	s := &jsonStore{path: path, backups: backups}
+	if err := s.load(); errors.Is(err, os.ErrNotExist) {
+		s.state = appState{
+			Projects: defaultProjects(),
+			Records:  []record{},
+		}
+	} else if err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// readJSONStore opens the data file at path only to read it. A file in an
+// older format is upgraded in memory but left as it is on disk.
+func readJSONStore(path string) (*jsonStore, error) {
+	s := &jsonStore{path: path, readOnly: true}
+	if err := s.load(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// load reads the file into memory. A file in an older format is saved in
+// the current one right away, so every process opening it afterwards sees
+// the same IDs the upgrade handed out.
+func (s *jsonStore) load() error {
+	info, err := os.Stat(s.path)
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(s.path)
+	if err != nil {
+		return err
+	}
+	var header struct {
+		SchemaVersion int `json:"schema_version"`
+	}
+	json.Unmarshal(data, &header) // Errors are reported by migrateJSON
+	if s.state, err = migrateJSON(s.path, data); err != nil {
+		return err
+	}
+	s.modTime = info.ModTime()
+	s.loads++
+	if header.SchemaVersion < schemaVersion && !s.readOnly {
+		return s.write()
+	}
+	return nil
+}
+
+// refresh reloads the file if another fishtime process (e.g. a CLI command
+// while the TUI is open) changed it since it was last read or written
+func (s *jsonStore) refresh() error {
+	info, err := os.Stat(s.path)
+	if err != nil || info.ModTime().Equal(s.modTime) {
+		return nil
+	}
+	return s.load()
+}
+
+func (s *jsonStore) Projects() ([]projectEntry, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return append([]projectEntry(nil), s.state.Projects...), nil
+}
+
+func (s *jsonStore) SaveProjects(projects []projectEntry) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.state.Projects = append([]projectEntry(nil), projects...)
+	return s.write()
+}
+
+func (s *jsonStore) Records() ([]record, error) {
+	if err := s.refresh(); err != nil {
+		return nil, err
+	}
+	return append([]record(nil), s.state.Records...), nil
+}
+
+func (s *jsonStore) AddRecord(r record) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.state.Records = append(s.state.Records, r)
+	return s.write()
+}
+
+func (s *jsonStore) AddRecords(records []record) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.state.Records = append(s.state.Records, records...)
+	return s.write()
+}
+
+func (s *jsonStore) UpdateRecord(r record) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	i := s.indexOf(r.ID)
+	if i < 0 {
+		return fmt.Errorf("record %s does not exist", r.ID)
+	}
+	s.state.Records[i] = r
+	return s.write()
+}
+
+func (s *jsonStore) UpdateRecords(records []record) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if err := s.replaceRecords(records); err != nil {
+		return err
+	}
+	return s.write()
+}
+
+func (s *jsonStore) DeleteRecord(id string) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	i := s.indexOf(id)
+	if i < 0 {
+		return fmt.Errorf("record %s does not exist", id)
+	}
+	s.state.Records = append(s.state.Records[:i], s.state.Records[i+1:]...)
+	return s.write()
+}
+
+func (s *jsonStore) DeleteRecords(ids []string) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	// Check every ID first so a missing one changes nothing
+	drop := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		if s.indexOf(id) < 0 {
+			return fmt.Errorf("record %s does not exist", id)
+		}
+		drop[id] = true
+	}
+	s.state.Records = slices.DeleteFunc(s.state.Records, func(r record) bool { return drop[r.ID] })
+	return s.write()
+}
+
+// replaceRecords puts records in place of the ones with the same IDs. It
+// checks every ID first so a missing one changes nothing.
+func (s *jsonStore) replaceRecords(records []record) error {
+	index := make([]int, len(records))
+	for j, r := range records {
+		if index[j] = s.indexOf(r.ID); index[j] < 0 {
+			return fmt.Errorf("record %s does not exist", r.ID)
+		}
+	}
+	for j, r := range records {
+		s.state.Records[index[j]] = r
+	}
+	return nil
+}
+
+// indexOf returns the position of the record with the given ID, or -1
+func (s *jsonStore) indexOf(id string) int {
+	for i, r := range s.state.Records {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (s *jsonStore) Timer() (timerState, error) {
+	if err := s.refresh(); err != nil {
+		return timerState{}, err
+	}
+	return timerState{
+		Running:   s.state.TimerRunning,
+		Start:     s.state.TimerStart,
+		ProjectID: s.state.TimerProjectID,
+	}, nil
+}
+
+func (s *jsonStore) SaveTimer(t timerState) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.state.TimerRunning = t.Running
+	s.state.TimerStart = t.Start
+	s.state.TimerProjectID = t.ProjectID
+	return s.write()
+}
+
+func (s *jsonStore) StopTimer(session record, t timerState) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	s.state.Records = append(s.state.Records, session)
+	s.state.TimerRunning = t.Running
+	s.state.TimerStart = t.Start
+	s.state.TimerProjectID = t.ProjectID
+	return s.write()
+}
+
+func (s *jsonStore) LastInvoice() (int, error) {
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	return s.state.LastInvoice, nil
+}
+
+func (s *jsonStore) SaveInvoice(n int, records []record) error {
+	if err := s.refresh(); err != nil {
+		return err
+	}
+	if err := s.replaceRecords(records); err != nil {
+		return err
+	}
+	s.state.LastInvoice = n
+	return s.write()
+}
+
+func (s *jsonStore) DataVersion() (int64, error) {
+	if err := s.refresh(); err != nil {
+		return 0, err
+	}
+	return s.loads, nil
+}
+
+func (s *jsonStore) Close() error { return nil }
+
+func (s *jsonStore) write() error {
+	if s.readOnly {
+		return fmt.Errorf("%s was opened read-only", s.path)
+	}
+	// Keep a copy of the file as it was before this session changed it
+	if !s.backedUp {
+		if err := backupFile(s.path, s.backups); err != nil {
+			return fmt.Errorf("backing up %s: %w", s.path, err)
+		}
+		s.backedUp = true
+	}
+	s.state.SchemaVersion = schemaVersion
+	data, err := json.MarshalIndent(s.state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := atomicWriteFile(s.path, data, 0644); err != nil {
+		return err
+	}
+	if info, err := os.Stat(s.path); err == nil {
+		s.modTime = info.ModTime()
+	}
+	return nil
+}
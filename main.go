@@ -1,6 +1,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 
@@ -8,7 +9,85 @@ import (
 )
 
 func main() {
-	p := tea.NewProgram(newModel(), tea.WithAltScreen())
+	var opts storeOptions
+	dataDir := flag.String("data", "", "data directory (default $"+dataEnvVar+" or $XDG_DATA_HOME/fishtime)")
+	flag.StringVar(&opts.Backend, "store", "json", "storage backend: json or sqlite (migrates timer_data.json on first use)")
+	flag.IntVar(&opts.Backups, "backups", 5, "number of timestamped backups of the data file to keep, at most one per hour (0 disables)")
+	round := flag.String("round", os.Getenv(roundEnvVar), "bill time rounded up to this many minutes per record, e.g. 6 or 15 (default exact, or $"+roundEnvVar+")")
+	weekStartName := flag.String("week-start", os.Getenv(weekStartEnvVar), "first day of the week for \"This week\" (default monday, or $"+weekStartEnvVar+")")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [command]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Without a command the TUI starts. Commands:")
+		fmt.Fprintln(flag.CommandLine.Output(), "  start <project>   start the timer")
+		fmt.Fprintln(flag.CommandLine.Output(), "  stop              stop the timer and record the session (--note)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  switch <project>  stop the running timer and start another")
+		fmt.Fprintln(flag.CommandLine.Output(), "  status            show the running timer (--json, --format for prompts and status bars)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  report            per-project totals (--from, --to, --by day|week|month, --depth, --project)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  export            write records as csv, json lines, md or ics (--format, --period, --from, --to, --project, -o)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  import FILE...    import Timewarrior, Watson or Toggl CSV data (--from, --dry-run)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  rate <project>    show or set the hourly rate (rate Acme 80 EUR, 0 to use the parent's)")
+		fmt.Fprintln(flag.CommandLine.Output(), "  invoice           bill a client's uninvoiced records as html or md (--client, --from, --to, --tax, -o, --dry-run, --void)")
+		fmt.Fprintln(flag.CommandLine.Output(), "\nFlags:")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	if *weekStartName != "" {
+		day, err := parseWeekday(*weekStartName)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		weekStart = day
+	}
+	if *round != "" {
+		increment, err := parseIncrement(*round)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		billingIncrement = increment
+	}
+
+	dir, err := resolveDataDir(*dataDir)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	opts.Dir = dir
+	// Only the TUI offers the move, so subcommands keep their output clean
+	// for scripts and status bars
+	if flag.NArg() == 0 {
+		interactive := isTerminal(os.Stdin) && isTerminal(os.Stdout)
+		if err := offerLegacyMigration(dir, os.Stdin, os.Stderr, interactive); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: migrating legacy data: %v\n", err)
+			os.Exit(1)
+		}
+	}
+
+	store, err := openStore(opts)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	defer store.Close()
+
+	// Subcommands run against the same data and exit without the TUI
+	if flag.NArg() > 0 {
+		if err := runCommand(store, flag.Args(), os.Stdout); err != nil {
+			store.Close()
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	m, err := newModel(store)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		os.Exit(1)
+	}
+	p := tea.NewProgram(m, tea.WithAltScreen())
 	if _, err := p.Run(); err != nil {
 		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
 		os.Exit(1)
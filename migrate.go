@@ -0,0 +1,204 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+)
+
+// schemaVersion is the data format written by this build. Every change to the
+// persisted format bumps it and appends a step to both migration lists below.
+const schemaVersion = 8
+
+// jsonMigrations upgrade a decoded timer_data.json; entry i moves a file from
+// version i to i+1
+var jsonMigrations = []func(doc map[string]any) error{
+	// 0 -> 1: files written before versioning need no structural change
+	func(doc map[string]any) error { return nil },
+	// 1 -> 2: stable IDs, records link to projects by ID instead of name
+	migrateJSONToIDs,
+	// 2 -> 3: projects can be archived, absent means active
+	func(doc map[string]any) error { return nil },
+	// 3 -> 4: records can have a note, absent means none
+	func(doc map[string]any) error { return nil },
+	// 4 -> 5: records can have tags, absent means none
+	func(doc map[string]any) error { return nil },
+	// 5 -> 6: projects nest under clients and projects, absent means top level
+	func(doc map[string]any) error { return nil },
+	// 6 -> 7: projects can have a rate, records can be non-billable; absent
+	// means no rate and billable
+	func(doc map[string]any) error { return nil },
+	// 7 -> 8: records remember the invoice that billed them, absent means not
+	// invoiced yet
+	func(doc map[string]any) error { return nil },
+}
+
+// sqliteMigrations upgrade a database; entry i moves it from user_version i
+// to i+1
+var sqliteMigrations = []string{
+	// 0 -> 1: initial schema
+	sqliteSchema,
+	// 1 -> 2: same as migrateJSONToIDs
+	`
+ALTER TABLE projects ADD COLUMN id TEXT NOT NULL DEFAULT '';
+INSERT INTO projects (position, name, selected)
+	SELECT (SELECT coalesce(max(position), -1) FROM projects) + row_number() OVER (ORDER BY min(r.id)), r.project, 0
+	FROM records r
+	WHERE r.project <> '' AND r.project NOT IN (SELECT name FROM projects)
+	GROUP BY r.project;
+UPDATE projects SET id = lower(hex(randomblob(8)));
+CREATE UNIQUE INDEX projects_id ON projects(id);
+
+CREATE TABLE records_v2 (
+	id         TEXT PRIMARY KEY,
+	project_id TEXT NOT NULL,
+	duration   INTEGER NOT NULL,
+	start_time INTEGER NOT NULL -- Unix nanoseconds
+);
+INSERT INTO records_v2 (id, project_id, duration, start_time)
+	SELECT lower(hex(randomblob(8))), coalesce((SELECT p.id FROM projects p WHERE p.name = r.project ORDER BY p.position LIMIT 1), ''), r.duration, r.start_time
+	FROM records r ORDER BY r.id;
+DROP TABLE records;
+ALTER TABLE records_v2 RENAME TO records;
+CREATE INDEX records_start_time ON records(start_time);
+CREATE INDEX records_project ON records(project_id, start_time);
+
+ALTER TABLE timer ADD COLUMN project_id TEXT NOT NULL DEFAULT '';
+UPDATE timer SET project_id = coalesce((SELECT p.id FROM projects p WHERE p.name = timer.project ORDER BY p.position LIMIT 1), '');
+ALTER TABLE timer DROP COLUMN project;
+`,
+	// 2 -> 3: projects can be archived
+	`ALTER TABLE projects ADD COLUMN archived INTEGER NOT NULL DEFAULT 0;`,
+	// 3 -> 4: records can have a note
+	`ALTER TABLE records ADD COLUMN note TEXT NOT NULL DEFAULT '';`,
+	// 4 -> 5: records can have tags, stored space separated
+	`ALTER TABLE records ADD COLUMN tags TEXT NOT NULL DEFAULT '';`,
+	// 5 -> 6: projects nest under clients and projects
+	`
+ALTER TABLE projects ADD COLUMN parent_id TEXT NOT NULL DEFAULT '';
+ALTER TABLE projects ADD COLUMN collapsed INTEGER NOT NULL DEFAULT 0;
+`,
+	// 6 -> 7: hourly rates on projects, non-billable records
+	`
+ALTER TABLE projects ADD COLUMN rate REAL NOT NULL DEFAULT 0;
+ALTER TABLE projects ADD COLUMN currency TEXT NOT NULL DEFAULT '';
+ALTER TABLE records ADD COLUMN non_billable INTEGER NOT NULL DEFAULT 0;
+`,
+	// 7 -> 8: records remember their invoice; the invoice number sequence
+	// lives in meta
+	`ALTER TABLE records ADD COLUMN invoice TEXT NOT NULL DEFAULT '';`,
+}
+
+// migrateJSONToIDs gives every project and record an ID and links records to
+// their project by matching names. Records whose project no longer exists
+// get it recreated so they show up again.
+func migrateJSONToIDs(doc map[string]any) error {
+	projects, _ := doc["projects"].([]any)
+	ids := make(map[string]string)
+	for _, p := range projects {
+		project, ok := p.(map[string]any)
+		if !ok {
+			continue
+		}
+		id := newID()
+		project["id"] = id
+		if name, ok := project["name"].(string); ok {
+			if _, dup := ids[name]; !dup {
+				ids[name] = id
+			}
+		}
+	}
+
+	records, _ := doc["records"].([]any)
+	for _, r := range records {
+		rec, ok := r.(map[string]any)
+		if !ok {
+			continue
+		}
+		name, _ := rec["project"].(string)
+		id, ok := ids[name]
+		if !ok && name != "" {
+			id = newID()
+			ids[name] = id
+			projects = append(projects, map[string]any{"id": id, "name": name, "selected": false})
+		}
+		rec["id"] = newID()
+		rec["project_id"] = id
+		delete(rec, "project")
+	}
+	doc["projects"] = projects
+
+	if name, ok := doc["timer_project"].(string); ok {
+		doc["timer_project_id"] = ids[name]
+		delete(doc, "timer_project")
+	}
+	return nil
+}
+
+// newerSchemaError explains why a file from a newer fishtime cannot be opened
+func newerSchemaError(path string, version int) error {
+	return fmt.Errorf("%s uses data format version %d, but this fishtime only understands up to version %d; please upgrade fishtime", path, version, schemaVersion)
+}
+
+// migrateJSON decodes data, upgrades it step by step to schemaVersion and
+// returns the result as an appState
+func migrateJSON(path string, data []byte) (appState, error) {
+	var doc map[string]any
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return appState{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	version := 0
+	if v, ok := doc["schema_version"].(float64); ok {
+		version = int(v)
+	}
+	if version > schemaVersion {
+		return appState{}, newerSchemaError(path, version)
+	}
+	for ; version < schemaVersion; version++ {
+		if err := jsonMigrations[version](doc); err != nil {
+			return appState{}, fmt.Errorf("upgrading %s from version %d: %w", path, version, err)
+		}
+		doc["schema_version"] = version + 1
+	}
+
+	var state appState
+	migrated, err := json.Marshal(doc)
+	if err != nil {
+		return appState{}, err
+	}
+	if err := json.Unmarshal(migrated, &state); err != nil {
+		return appState{}, fmt.Errorf("reading %s: %w", path, err)
+	}
+	return state, nil
+}
+
+// migrateSQLite upgrades the database to schemaVersion, one transaction per
+// step
+func migrateSQLite(db *sql.DB, path string) error {
+	var version int
+	if err := db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		return err
+	}
+	if version > schemaVersion {
+		return newerSchemaError(path, version)
+	}
+	for ; version < schemaVersion; version++ {
+		tx, err := db.Begin()
+		if err != nil {
+			return err
+		}
+		if _, err := tx.Exec(sqliteMigrations[version]); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("upgrading %s from version %d: %w", path, version, err)
+		}
+		// PRAGMA does not accept bound parameters
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, version+1)); err != nil {
+			tx.Rollback()
+			return err
+		}
+		if err := tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// checkMigrated checks data upgraded from a version 0 or 1 file holding
+// projects A and B, a record of A and a record of the deleted project Gone,
+// with the timer running on A
+func checkMigrated(t *testing.T, projects []projectEntry, records []record, timer timerState) {
+	t.Helper()
+	ids := make(map[string]string)
+	for _, p := range projects {
+		if p.ID == "" {
+			t.Errorf("project %q has no ID", p.Name)
+		}
+		ids[p.Name] = p.ID
+	}
+	for _, name := range []string{"A", "B", "Gone"} {
+		if ids[name] == "" {
+			t.Errorf("project %q missing after upgrade, got %v", name, projects)
+		}
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want 2", len(records))
+	}
+	want := map[int64]string{60: "A", 120: "Gone"}
+	for _, r := range records {
+		if r.ID == "" {
+			t.Errorf("record of %ds has no ID", r.Duration)
+		}
+		if r.ProjectID != ids[want[r.Duration]] {
+			t.Errorf("record of %ds links to %q, want project %s", r.Duration, r.ProjectID, want[r.Duration])
+		}
+	}
+	if !timer.Running || timer.ProjectID != ids["A"] {
+		t.Errorf("timer = %+v, want running on A", timer)
+	}
+}
+
+func TestMigrateJSON(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC).Format(time.RFC3339)
+	legacy := `"projects": [{"name": "A", "selected": true}, {"name": "B", "selected": false}],
+		"records": [
+			{"project": "A", "duration": 60, "start_time": "` + start + `"},
+			{"project": "Gone", "duration": 120, "start_time": "` + start + `"}
+		],
+		"timer_running": true, "timer_start": "` + start + `", "timer_project": "A"`
+	for _, tt := range []struct {
+		name string
+		data string
+	}{
+		{"v0", `{` + legacy + `}`},
+		{"v1", `{"schema_version": 1, ` + legacy + `}`},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			state, err := migrateJSON("test.json", []byte(tt.data))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if state.SchemaVersion != schemaVersion {
+				t.Errorf("schema version %d, want %d", state.SchemaVersion, schemaVersion)
+			}
+			timer := timerState{Running: state.TimerRunning, Start: state.TimerStart, ProjectID: state.TimerProjectID}
+			checkMigrated(t, state.Projects, state.Records, timer)
+		})
+	}
+}
+
+func TestMigrateJSONNewer(t *testing.T) {
+	if _, err := migrateJSON("test.json", []byte(`{"schema_version": 999}`)); err == nil {
+		t.Error("file from a newer version opened without error")
+	}
+}
+
+func TestMigrateSQLite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "timer_data.db")
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC).UnixNano()
+	for _, stmt := range []struct {
+		query string
+		args  []any
+	}{
+		{sqliteSchema, nil},
+		{`INSERT INTO meta (key, value) VALUES ('initialized', 'test')`, nil},
+		{`INSERT INTO projects (position, name, selected) VALUES (0, 'A', 1), (1, 'B', 0)`, nil},
+		{`INSERT INTO records (project, duration, start_time) VALUES ('A', 60, ?), ('Gone', 120, ?)`, []any{start, start}},
+		{`INSERT INTO timer (id, running, start_time, project) VALUES (1, 1, ?, 'A')`, []any{start}},
+	} {
+		if _, err := db.Exec(stmt.query, stmt.args...); err != nil {
+			t.Fatal(err)
+		}
+	}
+	db.Close()
+
+	s, err := openSQLiteStore(path, "", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	var version int
+	if err := s.db.QueryRow(`PRAGMA user_version`).Scan(&version); err != nil {
+		t.Fatal(err)
+	}
+	if version != schemaVersion {
+		t.Errorf("user_version %d, want %d", version, schemaVersion)
+	}
+	projects, err := s.Projects()
+	if err != nil {
+		t.Fatal(err)
+	}
+	records, err := s.Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	timer, err := s.Timer()
+	if err != nil {
+		t.Fatal(err)
+	}
+	checkMigrated(t, projects, records, timer)
+}
@@ -1,8 +1,7 @@
 package main
 
 import (
-	"encoding/json"
-	"os"
+	"strings"
 	"time"
 
 	"github.com/charmbracelet/bubbles/list"
@@ -13,18 +12,37 @@ import (
 type model struct {
 	periods             list.Model
 	projects            list.Model
+	allProjects         []projectEntry // Every project, including archived ones hidden from the list
+	showArchived        bool
 	logs                list.Model
 	focused             string // "periods", "projects", or "logs"
+	logsView            string // "" for the records list, "summary" for per-project totals or "chart"
 	prevFocused         string // Tracks last left pane ("periods" or "projects")
 	timerRunning        bool
 	timerStart          time.Time
-	timerProject        string
+	timerProjectID      string
 	records             []record
 	width               int
 	height              int
 	popupActive         bool
+	renamingProjectID   string // Project being renamed by the project popup, empty when adding
+	newProjectParentID  string // Parent of the project being added, empty for a client or top-level project
+	deleteActive        bool
+	deleteProjectID     string // Project awaiting delete confirmation
+	reassigning         bool   // Delete dialog is asking where to move the records
+	reassignInput       textinput.Model
+	exportActive        bool
+	exportFormatInput   textinput.Model
+	exportPathInput     textinput.Model
 	helpActive          bool
+	periodOffset        int // Periods stepped back (negative) or forward with [ and ]
+	customFrom          time.Time
+	customTo            time.Time // Exclusive
+	customRangeActive   bool
+	customFromInput     textinput.Model
+	customToInput       textinput.Model
 	recordEditActive    bool
+	editingRecordID     string // Record being changed in the edit popup
 	newLogActive        bool
 	projectInput        textinput.Model
 	recordStartInput    textinput.Model
@@ -32,24 +50,43 @@ type model struct {
 	newLogProjectInput  textinput.Model
 	newLogStartInput    textinput.Model
 	newLogDurationInput textinput.Model
+	noteInput           textinput.Model // Note field of the record popups and the stop prompt
+	tagsInput           textinput.Model // Tags field of the record popups
+	tagFilter           map[string]bool // Tags the logs are filtered to, nil for all
+	tagFilterActive     bool
+	tagFilterInput      textinput.Model
+	stopNoteActive      bool
+	stopNoteRecordID    string // Record just created by stopping the timer
+	rateActive          bool
+	rateProjectID       string // Project whose rate the rate popup sets
+	rateInput           textinput.Model
 	errorMessage        string
+	saveError           string // Last failed save, shown in the status bar
+	statusMessage       string // Feedback on the last action, shown in the status bar
+	history             history
+	dataVersion         int64 // Store's DataVersion as last loaded
+	store               Store
 }
 
 type record struct {
-	Project   string    `json:"project"`
-	Duration  int64     `json:"duration"` // Seconds
-	StartTime time.Time `json:"start_time"`
+	ID          string    `json:"id"`
+	ProjectID   string    `json:"project_id"`
+	Duration    int64     `json:"duration"` // Seconds
+	StartTime   time.Time `json:"start_time"`
+	Note        string    `json:"note,omitempty"`
+	Tags        []string  `json:"tags,omitempty"`         // Normalized by parseTags; #tags in Note count too
+	NonBillable bool      `json:"non_billable,omitempty"` // Left out of earnings
+	Invoice     string    `json:"invoice,omitempty"`      // Number of the invoice that billed it
 }
 
 type appState struct {
-	Projects []struct {
-		Name     string `json:"name"`
-		Selected bool   `json:"selected"`
-	} `json:"projects"`
-	Records      []record  `json:"records"`
-	TimerRunning bool      `json:"timer_running"`
-	TimerStart   time.Time `json:"timer_start"`
-	TimerProject string    `json:"timer_project"`
+	SchemaVersion  int            `json:"schema_version"`
+	Projects       []projectEntry `json:"projects"`
+	Records        []record       `json:"records"`
+	TimerRunning   bool           `json:"timer_running"`
+	TimerStart     time.Time      `json:"timer_start"`
+	TimerProjectID string         `json:"timer_project_id"`
+	LastInvoice    int            `json:"last_invoice,omitempty"`
 }
 
 // Messages
@@ -57,71 +94,95 @@ type tickMsg struct{}
 
 // Item for list.Model
 type item struct {
-	name     string
-	selected bool
-	isRecord bool
-	record   record // Only used for logs pane
+	id          string // Project ID, unused for records
+	name        string // Project name, for records the path of their project
+	selected    bool
+	archived    bool
+	depth       int   // Level in the project tree
+	hasChildren bool  // Project has sub-projects or tasks
+	collapsed   bool  // Sub-projects are hidden
+	total       int64 // Seconds in the shown period, including sub-projects
+	isRecord    bool
+	record      record // Only used for logs pane
 }
 
 func (i item) Title() string {
 	if i.isRecord {
-		return formatItemTitle(i.record)
+		return formatItemTitle(i.record, i.name)
 	}
-	return i.name
+	title := i.name
+	if i.id != "" {
+		marker := "  "
+		if i.hasChildren && i.collapsed {
+			marker = "▸ "
+		} else if i.hasChildren {
+			marker = "▾ "
+		}
+		title = strings.Repeat("  ", i.depth) + marker + title
+	}
+	if i.archived {
+		title += " (archived)"
+	}
+	if i.total > 0 {
+		title += "  " + formatDuration(i.total)
+	}
+	return title
 }
 
 func (i item) Description() string { return "" }
-func (i item) FilterValue() string { return i.name }
+func (i item) FilterValue() string {
+	if i.isRecord {
+		return strings.TrimSpace(i.name + " " + i.record.Note + " " + formatTags(i.record.Tags))
+	}
+	return i.name
+}
 
-func newModel() model {
-	// Load state from file
-	var state appState
-	if data, err := os.ReadFile("timer_data.json"); err == nil {
-		json.Unmarshal(data, &state)
-	} else {
-		state = appState{
-			Projects: []struct {
-				Name     string `json:"name"`
-				Selected bool   `json:"selected"`
-			}{
-				{Name: "Project A", Selected: false},
-				{Name: "Project B", Selected: false},
-			},
-			Records:      []record{},
-			TimerRunning: false,
-		}
+func newModel(store Store) (model, error) {
+	// Load state from the store, noting its version first so changes made
+	// meanwhile are picked up by syncStore
+	dataVersion, err := store.DataVersion()
+	if err != nil {
+		return model{}, err
+	}
+	savedProjects, err := store.Projects()
+	if err != nil {
+		return model{}, err
+	}
+	records, err := store.Records()
+	if err != nil {
+		return model{}, err
+	}
+	timer, err := store.Timer()
+	if err != nil {
+		return model{}, err
 	}
 
 	// Initialize periods list
-	periodItems := []list.Item{
-		item{name: "All"},
-		item{name: "Year"},
-		item{name: "Month"},
-		item{name: "Week"},
-		item{name: "Day"},
+	periodItems := make([]list.Item, 0, len(periodNames)+1)
+	for _, name := range periodNames {
+		periodItems = append(periodItems, item{name: name})
 	}
+	periodItems = append(periodItems, item{name: customPeriod})
 	periods := list.New(periodItems, customDelegate{}, 0, 0)
 	periods.Title = "Period"
 	periods.SetShowStatusBar(false)
 	periods.SetShowHelp(false)
 
-	// Initialize projects list
-	projectItems := make([]list.Item, len(state.Projects))
-	for i, p := range state.Projects {
-		projectItems[i] = item{name: p.Name, selected: p.Selected}
-	}
-	projects := list.New(projectItems, customDelegate{}, 0, 0)
-	projects.Title = "Projects (Space to select, d to delete, n to add)"
+	// Projects list is filled by refreshProjects below, archived projects
+	// start hidden
+	projects := list.New(nil, customDelegate{}, 0, 0)
+	projects.Title = "Projects (Space toggle, C clear, n/N add, Enter fold, d delete)"
 	projects.SetShowStatusBar(false)
 	projects.SetShowHelp(false)
 
 	// Initialize logs list
-	logItems := make([]list.Item, len(state.Records))
-	for i, r := range state.Records {
-		logItems[i] = item{isRecord: true, record: r}
+	names := projectPaths(savedProjects)
+	logItems := make([]list.Item, len(records))
+	for i, r := range records {
+		logItems[i] = item{isRecord: true, record: r, name: names[r.ProjectID]}
 	}
 	logs := list.New(logItems, customDelegate{}, 0, 0)
-	logs.Title = "Records (e to edit, n to add, d to delete)"
+	logs.Title = "Records (e to edit, n to add, d to delete, x to export)"
 	logs.SetShowStatusBar(false)
 	logs.SetShowHelp(false)
 
@@ -151,33 +212,80 @@ func newModel() model {
 	newLogStartInput.CharLimit = 19
 	newLogStartInput.Width = 20
 
+	reassignInput := textinput.New()
+	reassignInput.Placeholder = "Enter project name"
+	reassignInput.CharLimit = 30
+	reassignInput.Width = 20
+
+	exportFormatInput := textinput.New()
+	exportFormatInput.Placeholder = exportFormats()
+	exportFormatInput.CharLimit = 10
+	exportFormatInput.Width = 20
+
+	exportPathInput := textinput.New()
+	exportPathInput.Placeholder = "fishtime-<time>.<format>"
+	exportPathInput.CharLimit = 200
+	exportPathInput.Width = 30
+
+	noteInput := textinput.New()
+	noteInput.Placeholder = "Optional note"
+	noteInput.CharLimit = 200
+	noteInput.Width = 30
+
+	tagsInput := textinput.New()
+	tagsInput.Placeholder = "meeting, review"
+	tagsInput.CharLimit = 100
+	tagsInput.Width = 30
+
+	tagFilterInput := textinput.New()
+	tagFilterInput.Placeholder = "empty shows all"
+	tagFilterInput.CharLimit = 100
+	tagFilterInput.Width = 30
+
+	rateInput := textinput.New()
+	rateInput.Placeholder = "80 EUR, empty uses the parent's"
+	rateInput.CharLimit = 20
+	rateInput.Width = 30
+
+	customFromInput := textinput.New()
+	customFromInput.Placeholder = "YYYY-MM-DD"
+	customFromInput.CharLimit = 10
+	customFromInput.Width = 20
+
+	customToInput := textinput.New()
+	customToInput.Placeholder = "YYYY-MM-DD"
+	customToInput.CharLimit = 10
+	customToInput.Width = 20
+
 	newLogDurationInput := textinput.New()
 	newLogDurationInput.Placeholder = "hh:mm:ss"
 	newLogDurationInput.CharLimit = 8
 	newLogDurationInput.Width = 20
 
 	// Restore timer state
-	timerRunning := state.TimerRunning
+	timerRunning := timer.Running
 	var timerStart time.Time
-	timerProject := state.TimerProject
+	timerProjectID := timer.ProjectID
 	if timerRunning {
-		timerStart = state.TimerStart
+		timerStart = timer.Start
 		if timerStart.IsZero() {
 			timerRunning = false
-			timerProject = ""
+			timerProjectID = ""
 		}
 	}
 
-	return model{
+	m := model{
 		periods:             periods,
 		projects:            projects,
+		allProjects:         savedProjects,
 		logs:                logs,
 		focused:             "periods",
 		prevFocused:         "periods",
 		timerRunning:        timerRunning,
 		timerStart:          timerStart,
-		timerProject:        timerProject,
-		records:             state.Records,
+		timerProjectID:      timerProjectID,
+		dataVersion:         dataVersion,
+		records:             records,
 		width:               80,
 		height:              24,
 		popupActive:         false,
@@ -190,33 +298,198 @@ func newModel() model {
 		newLogProjectInput:  newLogProjectInput,
 		newLogStartInput:    newLogStartInput,
 		newLogDurationInput: newLogDurationInput,
+		reassignInput:       reassignInput,
+		exportFormatInput:   exportFormatInput,
+		exportPathInput:     exportPathInput,
+		noteInput:           noteInput,
+		tagsInput:           tagsInput,
+		tagFilterInput:      tagFilterInput,
+		rateInput:           rateInput,
+		customFromInput:     customFromInput,
+		customToInput:       customToInput,
 		errorMessage:        "",
+		store:               store,
 	}
+	m.refreshProjects()
+	return m, nil
 }
 
-func (m model) saveState() error {
-	state := appState{
-		Projects: make([]struct {
-			Name     string `json:"name"`
-			Selected bool   `json:"selected"`
-		}, len(m.projects.Items())),
-		Records:      m.records,
-		TimerRunning: m.timerRunning,
-		TimerStart:   m.timerStart,
-		TimerProject: m.timerProject,
-	}
-	for i, it := range m.projects.Items() {
-		p, ok := it.(item)
-		if ok {
-			state.Projects[i] = struct {
-				Name     string `json:"name"`
-				Selected bool   `json:"selected"`
-			}{Name: p.name, Selected: p.selected}
+// saveProjects persists the project list and selection
+func (m model) saveProjects() error {
+	return m.store.SaveProjects(m.allProjects)
+}
+
+// refreshProjects rebuilds the Projects pane tree from m.allProjects with
+// each project's total for the shown period. Children of collapsed projects
+// are hidden, as are archived projects and everything below them unless
+// they were asked for.
+func (m *model) refreshProjects() {
+	f := recordFilter{Tags: m.tagFilter}
+	f.From, f.To = m.periodRange()
+	totals := make(map[string]int64)
+	ancestors := projectAncestors(m.allProjects)
+	for _, r := range filterRecords(m.records, m.allProjects, f) {
+		totals[r.ProjectID] += r.Duration
+		for _, a := range ancestors[r.ProjectID] {
+			totals[a] += r.Duration
 		}
 	}
-	data, err := json.MarshalIndent(state, "", "  ")
+
+	var items []list.Item
+	hideBelow := -1 // Depth of a hidden or collapsed project whose subtree is skipped
+	for _, e := range projectTree(m.allProjects) {
+		if hideBelow >= 0 && e.depth > hideBelow {
+			continue
+		}
+		hideBelow = -1
+		if e.Archived && !m.showArchived {
+			hideBelow = e.depth
+			continue
+		}
+		items = append(items, item{
+			id:          e.ID,
+			name:        e.Name,
+			selected:    e.Selected,
+			archived:    e.Archived,
+			depth:       e.depth,
+			hasChildren: e.hasChildren,
+			collapsed:   e.Collapsed,
+			total:       totals[e.ID],
+		})
+		if e.Collapsed {
+			hideBelow = e.depth
+		}
+	}
+	index := m.projects.Index()
+	m.projects.SetItems(items)
+	if index >= len(items) {
+		m.projects.Select(len(items) - 1)
+	}
+}
+
+// refreshLogs rebuilds the logs pane from the current filters, along with
+// the project totals that depend on them
+func (m *model) refreshLogs() {
+	m.refreshProjects()
+	filtered := m.filteredRecords()
+	paths := projectPaths(m.allProjects)
+	logItems := make([]list.Item, len(filtered))
+	for i, r := range filtered {
+		logItems[i] = recordItem(r, paths)
+	}
+	m.logs.SetItems(logItems)
+}
+
+// projectIndex returns the position of the project with the given ID in
+// m.allProjects, or -1
+func (m model) projectIndex(id string) int {
+	for i, p := range m.allProjects {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// saveTimer persists the timer state
+func (m model) saveTimer() error {
+	return m.store.SaveTimer(timerState{
+		Running:   m.timerRunning,
+		Start:     m.timerStart,
+		ProjectID: m.timerProjectID,
+	})
+}
+
+// projectByName finds a project, archived or not, by its path or its own
+// name when that is unambiguous
+func (m model) projectByName(name string) (projectEntry, bool) {
+	p, err := lookupProject(m.allProjects, name)
+	return p, err == nil
+}
+
+// validateProjectName checks a new name for the project with the given ID
+// (empty for a new project) under parentID and returns an error message, or
+// "" if it is valid. Names only need to be unique among siblings.
+func (m model) validateProjectName(name, id, parentID string) string {
+	if name == "" {
+		return "Project name cannot be empty"
+	}
+	if strings.Contains(name, pathSeparator) {
+		return "Project name cannot contain " + pathSeparator
+	}
+	for _, p := range m.allProjects {
+		if p.Name == name && p.ParentID == parentID && p.ID != id {
+			return "Project name already exists"
+		}
+	}
+	return ""
+}
+
+// recordItem builds the logs pane item for r, with paths from projectPaths
+// built once for all the records shown
+func recordItem(r record, paths map[string]string) item {
+	return item{isRecord: true, record: r, name: paths[r.ProjectID]}
+}
+
+// projectRecordCount returns how many records belong to the project
+func (m model) projectRecordCount(id string) int {
+	n := 0
+	for _, r := range m.records {
+		if r.ProjectID == id {
+			n++
+		}
+	}
+	return n
+}
+
+// recordIndex returns the position of the record with the given ID in
+// m.records, or -1
+func (m model) recordIndex(id string) int {
+	for i, r := range m.records {
+		if r.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// syncStore picks up changes made outside the TUI, e.g. by `fishtime stop`
+// bound to a window manager key or `fishtime invoice` marking records.
+// Edits write whole records back, so working on stale copies would undo
+// those changes. Undo history is dropped for the same reason.
+func (m *model) syncStore() {
+	v, err := m.store.DataVersion()
+	if err != nil || v == m.dataVersion {
+		return
+	}
+	projects, err := m.store.Projects()
 	if err != nil {
-		return err
+		return
+	}
+	records, err := m.store.Records()
+	if err != nil {
+		return
+	}
+	t, err := m.store.Timer()
+	if err != nil {
+		return
+	}
+	m.dataVersion = v
+	m.allProjects = projects
+	m.records = records
+	m.timerRunning = t.Running && !t.Start.IsZero()
+	m.timerStart = t.Start
+	m.timerProjectID = t.ProjectID
+	m.history = history{}
+	m.refreshLogs()
+}
+
+// reportSave shows a failed save in the status bar, or clears the message
+// once saving works again
+func (m *model) reportSave(err error) {
+	if err != nil {
+		m.saveError = err.Error()
+	} else {
+		m.saveError = ""
 	}
-	return os.WriteFile("timer_data.json", data, 0644)
 }
@@ -3,11 +3,13 @@ package main
 import (
 	"fmt"
 	"io"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/bubbles/list"
   "github.com/charmbracelet/lipgloss"
+	"github.com/charmbracelet/x/ansi"
 )
 
 // Custom delegate to control list rendering
@@ -68,20 +70,49 @@ func (m model) View() string {
 		logsStyle = focusedStyle
 	}
 
+	m.periods.Title = m.periodTitle()
 	periodsRendered := periodsStyle.Width(sizes.Periods.Width).Height(sizes.Periods.Height).Render(m.periods.View())
 	projectsRendered := projectsStyle.Width(sizes.Projects.Width).Height(sizes.Projects.Height).Render(m.projects.View())
 
 	// Right panel: Logs with total
 	total := m.totalDuration()
-	totalStr := totalFooterStyle.Render(fmt.Sprintf("Total: %s", formatDuration(int64(total.Seconds()))))
-	logsContent := lipgloss.JoinVertical(lipgloss.Left, m.logs.View(), totalStr)
+	totalLabel := "Total"
+	if n := m.selectedCount(); n > 1 {
+		totalLabel = fmt.Sprintf("Total (%d projects)", n)
+	}
+	if len(m.tagFilter) > 0 {
+		var tags []string
+		for t := range m.tagFilter {
+			tags = append(tags, t)
+		}
+		totalLabel += " " + formatTags(uniqueTags(tags))
+	}
+	footer := fmt.Sprintf("%s: %s", totalLabel, formatDuration(int64(total.Seconds())))
+	if earned := m.totalEarnings().String(); earned != "" {
+		footer += "  Earned: " + earned
+	}
+	totalStr := totalFooterStyle.Render(footer)
+	logsView := m.logs.View()
+	switch m.logsView {
+	case "summary":
+		logsView = m.renderSummary(sizes.Logs.Width-6, m.logs.Height())
+	case "chart":
+		logsView = m.renderChart(sizes.Logs.Width-6, m.logs.Height())
+	}
+	logsContent := lipgloss.JoinVertical(lipgloss.Left, logsView, totalStr)
 	logsRendered := logsStyle.Width(sizes.Logs.Width).Height(sizes.Logs.Height).Render(logsContent)
 
 	// Status bar
 	status := "Timer: Off"
 	if m.timerRunning {
 		elapsed := time.Since(m.timerStart)
-		status = fmt.Sprintf("Timer: %s", formatDuration(int64(elapsed.Seconds())))
+		status = fmt.Sprintf("Timer: %s %s", projectPaths(m.allProjects)[m.timerProjectID], formatDuration(int64(elapsed.Seconds())))
+	}
+	if m.statusMessage != "" {
+		status += "  " + m.statusMessage
+	}
+	if m.saveError != "" {
+		status += "  " + errorStyle.Render("Save failed: "+m.saveError)
 	}
 	timerStyle := timerOffStyle
 	if m.timerRunning {
@@ -96,7 +127,13 @@ func (m model) View() string {
 
 	// Popups
 	if m.popupActive {
-		popupContent := "New Project\n" + m.projectInput.View() + "\nEnter to confirm, Esc to cancel"
+		title := "New Project"
+		if m.renamingProjectID != "" {
+			title = "Rename Project"
+		} else if m.newProjectParentID != "" {
+			title = "New Sub-project of " + projectPaths(m.allProjects)[m.newProjectParentID]
+		}
+		popupContent := title + "\n" + m.projectInput.View() + "\nEnter to confirm, Esc to cancel"
 		if m.errorMessage != "" {
 			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
 		}
@@ -109,6 +146,8 @@ func (m model) View() string {
 			"Project: " + m.newLogProjectInput.View() + "\n" +
 			"Start Time: " + m.recordStartInput.View() + "\n" +
 			"Duration: " + m.recordDurationInput.View() + "\n" +
+			"Note: " + m.noteInput.View() + "\n" +
+			"Tags: " + m.tagsInput.View() + "\n" +
 			"Enter to confirm, Esc to cancel, Tab to switch fields"
 		if m.errorMessage != "" {
 			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
@@ -122,6 +161,20 @@ func (m model) View() string {
 			"Project: " + m.newLogProjectInput.View() + "\n" +
 			"Start Time: " + m.newLogStartInput.View() + "\n" +
 			"Duration: " + m.newLogDurationInput.View() + "\n" +
+			"Note: " + m.noteInput.View() + "\n" +
+			"Tags: " + m.tagsInput.View() + "\n" +
+			"Enter to confirm, Esc to cancel, Tab to switch fields"
+		if m.errorMessage != "" {
+			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
+		}
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
+	if m.exportActive {
+		popupContent := "Export Shown Records\n" +
+			"Format: " + m.exportFormatInput.View() + "\n" +
+			"File: " + m.exportPathInput.View() + "\n" +
 			"Enter to confirm, Esc to cancel, Tab to switch fields"
 		if m.errorMessage != "" {
 			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
@@ -130,6 +183,89 @@ func (m model) View() string {
 		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
 		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
 	}
+	if m.stopNoteActive {
+		popupContent := "Timer Stopped\n" +
+			"Note: " + m.noteInput.View() + "\n" +
+			"Enter to save, Esc to skip"
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
+	if m.rateActive {
+		paths := projectPaths(m.allProjects)
+		inherited := "none"
+		// The project can vanish while the popup is open if another
+		// process deletes it
+		if i := m.projectIndex(m.rateProjectID); i >= 0 {
+			if rate, currency := projectRate(m.allProjects, m.allProjects[i].ParentID); rate > 0 {
+				inherited = formatRate(rate, currency)
+			}
+		}
+		popupContent := "Hourly Rate of " + paths[m.rateProjectID] + "\n" +
+			"Rate: " + m.rateInput.View() + "\n" +
+			"From parent: " + inherited + "\n" +
+			"Enter to confirm, Esc to cancel"
+		if m.errorMessage != "" {
+			popupContent += "\n" + errorStyle.Render(m.errorMessage)
+		}
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
+	if m.tagFilterActive {
+		known := formatTags(allTags(m.records))
+		if known == "" {
+			known = "none yet, add them in the record popups or as #tags in notes"
+		}
+		popupContent := "Filter by Tags\n" +
+			"Tags: " + m.tagFilterInput.View() + "\n" +
+			"Known: " + known + "\n" +
+			"Records with any of the tags are shown\n" +
+			"Enter to confirm, Esc to cancel"
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
+	if m.customRangeActive {
+		popupContent := "Custom Date Range (empty = open)\n" +
+			"From: " + m.customFromInput.View() + "\n" +
+			"To:   " + m.customToInput.View() + "\n" +
+			"Enter to confirm, Esc to cancel, Tab to switch fields"
+		if m.errorMessage != "" {
+			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
+		}
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
+	if m.deleteActive {
+		name := ""
+		if i := m.projectIndex(m.deleteProjectID); i >= 0 {
+			name = m.allProjects[i].Name
+		}
+		count := m.projectRecordCount(m.deleteProjectID)
+		popupContent := fmt.Sprintf("Delete Project %q?\n", name)
+		if m.reassigning {
+			popupContent += fmt.Sprintf("Move its %d records to: ", count) + m.reassignInput.View() + "\n" +
+				"Enter to confirm, Esc to go back"
+		} else if count > 0 {
+			popupContent += fmt.Sprintf("It has %d records.\n", count) +
+				"y - Delete it and its records\n" +
+				"r - Delete it and move its records to another project\n" +
+				"a - Archive it instead\n" +
+				"Esc to cancel"
+		} else {
+			popupContent += "y - Delete it\n" +
+				"a - Archive it instead\n" +
+				"Esc to cancel"
+		}
+		if m.errorMessage != "" {
+			popupContent += "\n" + errorStyle.Render("Error: "+m.errorMessage)
+		}
+		popup := popupStyle.Render(popupContent)
+		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
+		return lipgloss.JoinVertical(lipgloss.Left, content, popup)
+	}
 	if m.helpActive {
 		helpText := `Keyboard Shortcuts
 ?        - Show this help
@@ -139,11 +275,26 @@ shift+tab - Move focus up
 j, k      - Navigate items
 l, right  - Focus logs pane
 h, left   - Return to previous pane
-space     - Select project
+space     - Toggle project in the filter (in Projects)
+C         - Clear project filter (in Projects)
 n         - Add new project (in Projects) or record (in Logs)
+N         - Add sub-project or task under cursor (in Projects)
+enter     - Fold/unfold sub-projects (in Projects)
 d         - Delete project (in Projects) or record (in Logs)
+r         - Rename project (in Projects)
+a         - Archive/restore project (in Projects)
+A         - Show/hide archived projects (in Projects)
+$         - Set hourly rate and currency (in Projects)
 e         - Edit record (in Logs)
-s         - Start/stop timer
+b         - Toggle billable (in Logs)
+x         - Export shown records (in Logs)
+v         - Cycle records, per-project totals and chart (in Logs)
+c         - Pick a custom date range (in Period)
+t         - Filter records by tags
+[, ]      - Previous/next period
+s         - Start timer for project under cursor / stop timer
+u         - Undo last change
+ctrl+r    - Redo
 Press any key to close`
 		popup := popupStyle.Width(50).Render(helpText)
 		popup = lipgloss.Place(m.width, m.height, lipgloss.Center, lipgloss.Center, popup)
@@ -152,3 +303,54 @@ Press any key to close`
 
 	return content
 }
+
+// renderSummary lists each project's share of the shown records, largest
+// first, with a bar scaled to the pane width
+func (m model) renderSummary(width, height int) string {
+	records := m.filteredRecords()
+	lines := []string{summaryTitleStyle.Render("Per-Project Totals")}
+	var total int64
+	for _, r := range records {
+		total += r.Duration
+	}
+	if total == 0 {
+		return lipgloss.NewStyle().Height(height).Render(lipgloss.JoinVertical(lipgloss.Left, append(lines, "", "No records in this period")...))
+	}
+
+	totals := totalsByProject(records, projectPaths(m.allProjects))
+	// Records count towards each of their tags, so tag shares can add up to
+	// more than 100%
+	tagTotals := totalsByTag(records)
+	nameWidth := 0
+	for _, t := range append(totals, tagTotals...) {
+		nameWidth = max(nameWidth, lipgloss.Width(t.name))
+	}
+	nameWidth = min(nameWidth, width/3)
+	// name, duration (8), share (6) and the spaces between them
+	barWidth := max(width-nameWidth-8-6-3, 1)
+	row := func(t projectTotal) string {
+		share := float64(t.seconds) / float64(total)
+		bar := summaryBarStyle.Render(strings.Repeat("█", max(int(share*float64(barWidth)+0.5), 1)))
+		// Padded by columns, as wide characters take two
+		name := truncate(t.name, nameWidth)
+		name += strings.Repeat(" ", max(nameWidth-lipgloss.Width(name), 0))
+		return fmt.Sprintf("%s %s %5.1f%% %s", name, formatDuration(t.seconds), 100*share, bar)
+	}
+
+	lines = append(lines, "")
+	for _, t := range totals {
+		lines = append(lines, row(t))
+	}
+	if len(tagTotals) > 0 {
+		lines = append(lines, "", summaryTitleStyle.Render("Per-Tag Totals"), "")
+		for _, t := range tagTotals {
+			lines = append(lines, row(t))
+		}
+	}
+	return lipgloss.NewStyle().Height(height).MaxHeight(height).Render(lipgloss.JoinVertical(lipgloss.Left, lines...))
+}
+
+// truncate shortens s to width columns, marking the cut with an ellipsis
+func truncate(s string, width int) string {
+	return ansi.Truncate(s, width, "…")
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// multiFlag collects a flag that may be given several times
+type multiFlag []string
+
+func (f *multiFlag) String() string     { return strings.Join(*f, ", ") }
+func (f *multiFlag) Set(v string) error { *f = append(*f, v); return nil }
+
+// parseDateRange turns --from/--to days (YYYY-MM-DD, local time, both
+// inclusive) into a recordFilter range
+func parseDateRange(from, to string) (recordFilter, error) {
+	var f recordFilter
+	if from != "" {
+		t, err := time.ParseInLocation("2006-01-02", from, time.Local)
+		if err != nil {
+			return f, fmt.Errorf("invalid --from %q (use YYYY-MM-DD)", from)
+		}
+		f.From = t
+	}
+	if to != "" {
+		t, err := time.ParseInLocation("2006-01-02", to, time.Local)
+		if err != nil {
+			return f, fmt.Errorf("invalid --to %q (use YYYY-MM-DD)", to)
+		}
+		f.To = t.AddDate(0, 0, 1)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return f, fmt.Errorf("--from %s is after --to %s", from, to)
+	}
+	return f, nil
+}
+
+// projectIDs resolves project names or paths, archived ones included, for
+// filtering. Each project brings everything below it. No names means every
+// project.
+func projectIDs(projects []projectEntry, names []string) (map[string]bool, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+	ids := make(map[string]bool)
+	for _, name := range names {
+		p, err := lookupProject(projects, name)
+		if err != nil {
+			return nil, err
+		}
+		ids[p.ID] = true
+	}
+	return withDescendants(projects, ids), nil
+}
+
+// rollupNames maps project IDs to their path cut to depth levels, so totals
+// add up to clients (1) or projects (2). Zero keeps full paths.
+func rollupNames(projects []projectEntry, depth int) map[string]string {
+	names := projectPaths(projects)
+	if depth <= 0 {
+		return names
+	}
+	for id, path := range names {
+		if parts := strings.Split(path, pathSeparator); len(parts) > depth {
+			names[id] = strings.Join(parts[:depth], pathSeparator)
+		}
+	}
+	return names
+}
+
+// tagFilter turns --tag values into a recordFilter tag set, nil for none
+func tagFilter(names []string) map[string]bool {
+	tags := parseTags(strings.Join(names, " "))
+	if len(tags) == 0 {
+		return nil
+	}
+	set := make(map[string]bool, len(tags))
+	for _, t := range tags {
+		set[t] = true
+	}
+	return set
+}
+
+// reportGroups maps --by values to a column title and a label for the
+// period a record starts in. Labels sort chronologically.
+var reportGroups = map[string]struct {
+	title string
+	label func(t time.Time) string
+}{
+	"day":   {"DAY", func(t time.Time) string { return t.Format("2006-01-02") }},
+	"week":  {"WEEK", func(t time.Time) string { y, w := t.ISOWeek(); return fmt.Sprintf("%d-W%02d", y, w) }},
+	"month": {"MONTH", func(t time.Time) string { return t.Format("2006-01") }},
+}
+
+// projectTotal is one project's time within a report group
+type projectTotal struct {
+	name    string
+	seconds int64
+}
+
+// totalsByProject sums records per project name, largest first
+func totalsByProject(records []record, names map[string]string) []projectTotal {
+	sums := make(map[string]int64)
+	for _, r := range records {
+		sums[names[r.ProjectID]] += r.Duration
+	}
+	totals := make([]projectTotal, 0, len(sums))
+	for name, seconds := range sums {
+		totals = append(totals, projectTotal{name, seconds})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].seconds != totals[j].seconds {
+			return totals[i].seconds > totals[j].seconds
+		}
+		return totals[i].name < totals[j].name
+	})
+	return totals
+}
+
+// fishtime report [--from DATE] [--to DATE] [--by day|week|month] [--depth N] [--project NAME]... [--tag TAG]...
+func cmdReport(store Store, args []string, out io.Writer) error {
+	fs := flag.NewFlagSet("report", flag.ContinueOnError)
+	from := fs.String("from", "", "first day to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last day to include (YYYY-MM-DD)")
+	by := fs.String("by", "", "also break totals down by day, week or month")
+	depth := fs.Int("depth", 0, "roll totals up to clients (1) or projects (2)")
+	var projectNames, tagNames multiFlag
+	fs.Var(&projectNames, "project", "only include this project and its sub-projects (repeatable)")
+	fs.Var(&tagNames, "tag", "only include records with this tag (repeatable)")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return fmt.Errorf("unexpected argument %q", fs.Arg(0))
+	}
+	if _, ok := reportGroups[*by]; *by != "" && !ok {
+		return fmt.Errorf("invalid --by %q (use day, week or month)", *by)
+	}
+	if *depth < 0 || *depth > maxProjectDepth {
+		return fmt.Errorf("invalid --depth %d (use 1 to %d)", *depth, maxProjectDepth)
+	}
+
+	f, err := parseDateRange(*from, *to)
+	if err != nil {
+		return err
+	}
+	f.Tags = tagFilter(tagNames)
+	projects, err := store.Projects()
+	if err != nil {
+		return err
+	}
+	if f.ProjectIDs, err = projectIDs(projects, projectNames); err != nil {
+		return err
+	}
+	records, err := store.Records()
+	if err != nil {
+		return err
+	}
+	filtered := filterRecords(records, projects, f)
+	if len(filtered) == 0 {
+		fmt.Fprintln(out, "No records in range")
+		return nil
+	}
+	names := rollupNames(projects, *depth)
+	writeReport(out, filtered, names, *by)
+	writeTagReport(out, filtered)
+	writeEarningsReport(out, filtered, projects, names)
+	return nil
+}
+
+// formatShare writes seconds as a percentage of total, "-" when no time was
+// tracked at all
+func formatShare(seconds, total int64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", 100*float64(seconds)/float64(total))
+}
+
+// writeTagReport prints per-tag totals after the project table when any of
+// the records are tagged
+func writeTagReport(out io.Writer, records []record) {
+	totals := totalsByTag(records)
+	if len(totals) == 0 {
+		return
+	}
+	var total int64
+	for _, r := range records {
+		total += r.Duration
+	}
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "TAG\tDURATION\tSHARE")
+	for _, t := range totals {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", t.name, formatDuration(t.seconds), formatShare(t.seconds, total))
+	}
+}
+
+// writeEarningsReport prints billed time and earnings per project after the
+// other tables when any of the records earn something. Billed time is
+// rounded per record to the billing increment.
+func writeEarningsReport(out io.Writer, records []record, projects []projectEntry, names map[string]string) {
+	total := earningsOf(records, projects)
+	if len(total) == 0 {
+		return
+	}
+	// Rows are per project and currency, a rolled up client can bill in
+	// several
+	type key struct{ name, currency string }
+	var keys []key
+	billed := make(map[key]int64)
+	amounts := make(map[key]float64)
+	rates := projectRates(projects)
+	for _, r := range records {
+		rate := rates[r.ProjectID]
+		if r.NonBillable || rate.rate == 0 {
+			continue
+		}
+		k := key{names[r.ProjectID], rate.currency}
+		if _, seen := billed[k]; !seen {
+			keys = append(keys, k)
+		}
+		billed[k] += billedSeconds(r.Duration)
+		amounts[k] += float64(billedSeconds(r.Duration)) / 3600 * rate.rate
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].name != keys[j].name {
+			return keys[i].name < keys[j].name
+		}
+		return keys[i].currency < keys[j].currency
+	})
+
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+	fmt.Fprintln(w)
+	fmt.Fprintln(w, "PROJECT\tBILLED\tEARNINGS")
+	var totalBilled int64
+	for _, k := range keys {
+		fmt.Fprintf(w, "%s\t%s\t%s\n", k.name, formatDuration(billed[k]), earnings{k.currency: amounts[k]})
+		totalBilled += billed[k]
+	}
+	fmt.Fprintf(w, "TOTAL\t%s\t%s\n", formatDuration(totalBilled), total)
+}
+
+// writeReport prints an aligned table of per-project totals, optionally
+// broken down by the --by period
+func writeReport(out io.Writer, records []record, names map[string]string, by string) {
+	w := tabwriter.NewWriter(out, 0, 0, 2, ' ', 0)
+	defer w.Flush()
+
+	var total int64
+	for _, r := range records {
+		total += r.Duration
+	}
+
+	group, ok := reportGroups[by]
+	if !ok {
+		fmt.Fprintln(w, "PROJECT\tDURATION\tSHARE")
+		for _, t := range totalsByProject(records, names) {
+			fmt.Fprintf(w, "%s\t%s\t%s\n", t.name, formatDuration(t.seconds), formatShare(t.seconds, total))
+		}
+		fmt.Fprintf(w, "TOTAL\t%s\n", formatDuration(total))
+		return
+	}
+
+	groups := make(map[string][]record)
+	var labels []string
+	for _, r := range records {
+		label := group.label(r.StartTime.Local())
+		if _, seen := groups[label]; !seen {
+			labels = append(labels, label)
+		}
+		groups[label] = append(groups[label], r)
+	}
+	sort.Strings(labels)
+
+	fmt.Fprintf(w, "%s\tPROJECT\tDURATION\n", group.title)
+	for _, label := range labels {
+		totals := totalsByProject(groups[label], names)
+		var subtotal int64
+		for i, t := range totals {
+			if i == 0 {
+				fmt.Fprintf(w, "%s\t%s\t%s\n", label, t.name, formatDuration(t.seconds))
+			} else {
+				fmt.Fprintf(w, "\t%s\t%s\n", t.name, formatDuration(t.seconds))
+			}
+			subtotal += t.seconds
+		}
+		if len(totals) > 1 {
+			fmt.Fprintf(w, "\t(total)\t%s\n", formatDuration(subtotal))
+		}
+	}
+	fmt.Fprintf(w, "TOTAL\t\t%s\n", formatDuration(total))
+}
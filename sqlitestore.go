@@ -0,0 +1,420 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite" // Pure-Go driver, no cgo needed
+)
+
+// sqliteSchema is the first version of the tables and indexes used by
+// sqliteStore; later changes go in sqliteMigrations
+const sqliteSchema = `
+CREATE TABLE IF NOT EXISTS projects (
+	position INTEGER PRIMARY KEY,
+	name     TEXT NOT NULL,
+	selected INTEGER NOT NULL DEFAULT 0
+);
+CREATE TABLE IF NOT EXISTS records (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	project    TEXT NOT NULL,
+	duration   INTEGER NOT NULL,
+	start_time INTEGER NOT NULL -- Unix nanoseconds
+);
+CREATE INDEX IF NOT EXISTS records_start_time ON records(start_time);
+CREATE INDEX IF NOT EXISTS records_project ON records(project, start_time);
+CREATE TABLE IF NOT EXISTS timer (
+	id         INTEGER PRIMARY KEY CHECK (id = 1),
+	running    INTEGER NOT NULL,
+	start_time INTEGER NOT NULL,
+	project    TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS meta (
+	key   TEXT PRIMARY KEY,
+	value TEXT NOT NULL
+);
+`
+
+// sqliteStore keeps data in an embedded SQLite database and writes each
+// change on its own instead of rewriting the whole history
+type sqliteStore struct {
+	db       *sql.DB
+	path     string
+	backups  int  // Number of backups to keep
+	backedUp bool // Whether this session already made its backup
+}
+
+// openSQLiteStore opens (or creates) the database at path, keeping up to
+// backups timestamped copies of it. A new database is seeded once from
+// legacyJSON if that file exists.
+func openSQLiteStore(path, legacyJSON string, backups int) (*sqliteStore, error) {
+	db, err := sql.Open("sqlite", path+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, err
+	}
+	// One connection, so PRAGMA data_version only counts other processes'
+	// commits
+	db.SetMaxOpenConns(1)
+	s := &sqliteStore{db: db, path: path, backups: backups}
+	if err := migrateSQLite(db, path); err != nil {
+		db.Close()
+		return nil, err
+	}
+	if err := s.seed(legacyJSON); err != nil {
+		db.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+// seed fills a freshly created database, migrating legacyJSON when present
+func (s *sqliteStore) seed(legacyJSON string) error {
+	var initialized string
+	err := s.db.QueryRow(`SELECT value FROM meta WHERE key = 'initialized'`).Scan(&initialized)
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, sql.ErrNoRows) {
+		return err
+	}
+
+	projects := defaultProjects()
+	var records []record
+	var timer timerState
+	var lastInvoice int
+	source := "defaults"
+	if _, err := os.Stat(legacyJSON); err == nil {
+		legacy, err := readJSONStore(legacyJSON)
+		if err != nil {
+			return fmt.Errorf("migrating %s: %w", legacyJSON, err)
+		}
+		projects, _ = legacy.Projects()
+		records, _ = legacy.Records()
+		timer, _ = legacy.Timer()
+		lastInvoice, _ = legacy.LastInvoice()
+		source = legacyJSON
+	}
+
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceProjects(tx, projects); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := insertRecord(tx, r); err != nil {
+			return err
+		}
+	}
+	if err := writeTimer(tx, timer); err != nil {
+		return err
+	}
+	if lastInvoice > 0 {
+		if err := writeLastInvoice(tx, lastInvoice); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`INSERT INTO meta (key, value) VALUES ('initialized', ?)`, source); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Projects() ([]projectEntry, error) {
+	rows, err := s.db.Query(`SELECT id, name, selected, archived, parent_id, collapsed, rate, currency FROM projects ORDER BY position`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var projects []projectEntry
+	for rows.Next() {
+		var p projectEntry
+		if err := rows.Scan(&p.ID, &p.Name, &p.Selected, &p.Archived, &p.ParentID, &p.Collapsed, &p.Rate, &p.Currency); err != nil {
+			return nil, err
+		}
+		projects = append(projects, p)
+	}
+	return projects, rows.Err()
+}
+
+func (s *sqliteStore) SaveProjects(projects []projectEntry) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := replaceProjects(tx, projects); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Records() ([]record, error) {
+	rows, err := s.db.Query(`SELECT id, project_id, duration, start_time, note, tags, non_billable, invoice FROM records ORDER BY rowid`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var records []record
+	for rows.Next() {
+		var start int64
+		var tags string
+		var r record
+		if err := rows.Scan(&r.ID, &r.ProjectID, &r.Duration, &start, &r.Note, &tags, &r.NonBillable, &r.Invoice); err != nil {
+			return nil, err
+		}
+		r.StartTime = time.Unix(0, start)
+		r.Tags = strings.Fields(tags)
+		records = append(records, r)
+	}
+	return records, rows.Err()
+}
+
+func (s *sqliteStore) AddRecord(r record) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	return insertRecord(s.db, r)
+}
+
+func (s *sqliteStore) AddRecords(records []record) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, r := range records {
+		if err := insertRecord(tx, r); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) UpdateRecord(r record) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	return updateRecord(s.db, r)
+}
+
+func (s *sqliteStore) UpdateRecords(records []record) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, r := range records {
+		if err := updateRecord(tx, r); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) DeleteRecord(id string) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	return deleteRecord(s.db, id)
+}
+
+func (s *sqliteStore) DeleteRecords(ids []string) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, id := range ids {
+		if err := deleteRecord(tx, id); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) Timer() (timerState, error) {
+	var t timerState
+	var start int64
+	err := s.db.QueryRow(`SELECT running, start_time, project_id FROM timer WHERE id = 1`).Scan(&t.Running, &start, &t.ProjectID)
+	if errors.Is(err, sql.ErrNoRows) {
+		return timerState{}, nil
+	}
+	if err != nil {
+		return timerState{}, err
+	}
+	if start != 0 {
+		t.Start = time.Unix(0, start)
+	}
+	return t, nil
+}
+
+func (s *sqliteStore) SaveTimer(t timerState) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	return writeTimer(s.db, t)
+}
+
+func (s *sqliteStore) StopTimer(session record, t timerState) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := insertRecord(tx, session); err != nil {
+		return err
+	}
+	if err := writeTimer(tx, t); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) LastInvoice() (int, error) {
+	var n int
+	err := s.db.QueryRow(`SELECT CAST(value AS INTEGER) FROM meta WHERE key = 'last_invoice'`).Scan(&n)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, nil
+	}
+	return n, err
+}
+
+func (s *sqliteStore) SaveInvoice(n int, records []record) error {
+	if err := s.backup(); err != nil {
+		return err
+	}
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := writeLastInvoice(tx, n); err != nil {
+		return err
+	}
+	for _, r := range records {
+		if err := updateRecord(tx, r); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+func (s *sqliteStore) DataVersion() (int64, error) {
+	var v int64
+	err := s.db.QueryRow(`PRAGMA data_version`).Scan(&v)
+	return v, err
+}
+
+func (s *sqliteStore) Close() error { return s.db.Close() }
+
+// backup snapshots the database before this session first changes it
+func (s *sqliteStore) backup() error {
+	if s.backedUp || s.backups <= 0 || !backupDue(s.path) {
+		s.backedUp = true
+		return nil
+	}
+	if err := os.MkdirAll(backupDir(s.path), 0755); err != nil {
+		return err
+	}
+	dest := filepath.Join(backupDir(s.path), backupName(s.path, time.Now()))
+	if _, err := os.Stat(dest); err != nil {
+		if _, err := s.db.Exec(`VACUUM INTO ?`, dest); err != nil {
+			return fmt.Errorf("backing up %s: %w", s.path, err)
+		}
+	}
+	s.backedUp = true
+	return pruneBackups(s.path, s.backups)
+}
+
+// execer is satisfied by both *sql.DB and *sql.Tx
+type execer interface {
+	Exec(query string, args ...any) (sql.Result, error)
+}
+
+func replaceProjects(tx execer, projects []projectEntry) error {
+	if _, err := tx.Exec(`DELETE FROM projects`); err != nil {
+		return err
+	}
+	for i, p := range projects {
+		if _, err := tx.Exec(`INSERT INTO projects (position, id, name, selected, archived, parent_id, collapsed, rate, currency) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			i, p.ID, p.Name, p.Selected, p.Archived, p.ParentID, p.Collapsed, p.Rate, p.Currency); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func insertRecord(db execer, r record) error {
+	_, err := db.Exec(`INSERT INTO records (id, project_id, duration, start_time, note, tags, non_billable, invoice) VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		r.ID, r.ProjectID, r.Duration, r.StartTime.UnixNano(), r.Note, strings.Join(r.Tags, " "), r.NonBillable, r.Invoice)
+	return err
+}
+
+func updateRecord(db execer, r record) error {
+	res, err := db.Exec(`UPDATE records SET project_id = ?, duration = ?, start_time = ?, note = ?, tags = ?, non_billable = ?, invoice = ? WHERE id = ?`,
+		r.ProjectID, r.Duration, r.StartTime.UnixNano(), r.Note, strings.Join(r.Tags, " "), r.NonBillable, r.Invoice, r.ID)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, r.ID)
+}
+
+func deleteRecord(db execer, id string) error {
+	res, err := db.Exec(`DELETE FROM records WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	return expectRow(res, id)
+}
+
+// expectRow fails when a statement meant for the record id touched nothing
+func expectRow(res sql.Result, id string) error {
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return fmt.Errorf("record %s does not exist", id)
+	}
+	return nil
+}
+
+func writeLastInvoice(db execer, n int) error {
+	_, err := db.Exec(`INSERT INTO meta (key, value) VALUES ('last_invoice', ?)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value`, fmt.Sprint(n))
+	return err
+}
+
+func writeTimer(db execer, t timerState) error {
+	var start int64
+	if !t.Start.IsZero() {
+		start = t.Start.UnixNano()
+	}
+	_, err := db.Exec(`INSERT INTO timer (id, running, start_time, project_id) VALUES (1, ?, ?, ?)
+		ON CONFLICT(id) DO UPDATE SET running = excluded.running, start_time = excluded.start_time, project_id = excluded.project_id`,
+		t.Running, start, t.ProjectID)
+	return err
+}
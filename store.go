@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// Store persists projects, records and timer state so the TUI and other
+// front ends can share the same data without knowing how it is kept
+type Store interface {
+	Projects() ([]projectEntry, error)
+	SaveProjects(projects []projectEntry) error
+	Records() ([]record, error)
+	AddRecord(r record) error
+	AddRecords(records []record) error // Adds all of them in one write
+	UpdateRecord(r record) error       // Replaces the record with the same ID
+	UpdateRecords(records []record) error
+	DeleteRecord(id string) error
+	DeleteRecords(ids []string) error
+	Timer() (timerState, error)
+	SaveTimer(t timerState) error
+	StopTimer(session record, t timerState) error // Adds the session and saves t in one write
+	DataVersion() (int64, error)                  // Changes when another process changed the data
+	LastInvoice() (int, error)                    // Number of the last invoice issued, 0 for none
+	SaveInvoice(n int, records []record) error    // Takes number n and marks records in one write
+	Close() error
+}
+
+// projectEntry is a persisted project
+type projectEntry struct {
+	ID        string  `json:"id"`
+	Name      string  `json:"name"`
+	Selected  bool    `json:"selected"`
+	Archived  bool    `json:"archived,omitempty"`  // Hidden from the Projects pane, records still count
+	ParentID  string  `json:"parent_id,omitempty"` // Client or project this sits under, empty at the top
+	Collapsed bool    `json:"collapsed,omitempty"` // Children hidden in the Projects pane
+	Rate      float64 `json:"rate,omitempty"`      // Hourly rate, 0 to use the parent's
+	Currency  string  `json:"currency,omitempty"`  // Currency of Rate, empty to use the parent's
+}
+
+// timerState is the persisted state of the running timer
+type timerState struct {
+	Running   bool
+	Start     time.Time
+	ProjectID string
+}
+
+// defaultProjects is used when no data has been saved yet
+func defaultProjects() []projectEntry {
+	return []projectEntry{
+		{ID: newID(), Name: "Project A", Selected: false},
+		{ID: newID(), Name: "Project B", Selected: false},
+	}
+}
+
+// newID returns a random identifier for a project or record
+func newID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// storeOptions selects and configures the storage backend
+type storeOptions struct {
+	Dir     string // Directory holding the data files
+	Backend string // "json" or "sqlite"
+	Backups int    // Number of timestamped backups to keep, 0 disables them
+}
+
+// openStore opens the storage backend described by opts
+func openStore(opts storeOptions) (Store, error) {
+	if opts.Backend != "json" && opts.Backend != "sqlite" {
+		return nil, fmt.Errorf("unknown store %q (use json or sqlite)", opts.Backend)
+	}
+	jsonPath := filepath.Join(opts.Dir, dataFileName)
+	if err := os.MkdirAll(opts.Dir, 0755); err != nil {
+		return nil, err
+	}
+	if opts.Backend == "sqlite" {
+		return openSQLiteStore(filepath.Join(opts.Dir, sqliteFileName), jsonPath, opts.Backups)
+	}
+	return openJSONStore(jsonPath, opts.Backups)
+}
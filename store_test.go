@@ -0,0 +1,221 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+// storeBackends are the backends every Store test runs against
+var storeBackends = []string{"json", "sqlite"}
+
+// openTestStore opens backend in dir and closes it when the test ends
+func openTestStore(t *testing.T, dir, backend string) Store {
+	t.Helper()
+	s, err := openStore(storeOptions{Dir: dir, Backend: backend})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { s.Close() })
+	return s
+}
+
+// recordIDs returns the IDs of records, sorted
+func recordIDs(records []record) []string {
+	ids := make([]string, len(records))
+	for i, r := range records {
+		ids[i] = r.ID
+	}
+	slices.Sort(ids)
+	return ids
+}
+
+// checkRecords checks that a new handle on dir reads records with these IDs
+// and durations
+func checkRecords(t *testing.T, dir, backend string, want map[string]int64) {
+	t.Helper()
+	records, err := openTestStore(t, dir, backend).Records()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := make(map[string]int64, len(records))
+	for _, r := range records {
+		got[r.ID] = r.Duration
+	}
+	if len(got) != len(want) {
+		t.Fatalf("stored records %v, want %v", got, want)
+	}
+	for id, d := range want {
+		if got[id] != d {
+			t.Fatalf("stored records %v, want %v", got, want)
+		}
+	}
+}
+
+func TestStoreRecords(t *testing.T) {
+	start := time.Date(2024, 3, 1, 9, 0, 0, 0, time.UTC)
+	rec := func(id string, d int64) record {
+		return record{ID: id, ProjectID: "p", Duration: d, StartTime: start}
+	}
+	for _, backend := range storeBackends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openTestStore(t, dir, backend)
+
+			if err := s.AddRecord(rec("a", 60)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.AddRecords([]record{rec("b", 60), rec("c", 60), rec("d", 60)}); err != nil {
+				t.Fatal(err)
+			}
+			checkRecords(t, dir, backend, map[string]int64{"a": 60, "b": 60, "c": 60, "d": 60})
+
+			if err := s.UpdateRecord(rec("a", 120)); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.UpdateRecords([]record{rec("b", 180), rec("c", 240)}); err != nil {
+				t.Fatal(err)
+			}
+			checkRecords(t, dir, backend, map[string]int64{"a": 120, "b": 180, "c": 240, "d": 60})
+
+			if err := s.DeleteRecord("d"); err != nil {
+				t.Fatal(err)
+			}
+			if err := s.DeleteRecords([]string{"b", "c"}); err != nil {
+				t.Fatal(err)
+			}
+			checkRecords(t, dir, backend, map[string]int64{"a": 120})
+
+			// A missing ID fails the whole call and changes nothing
+			if err := s.AddRecords([]record{rec("b", 60)}); err != nil {
+				t.Fatal(err)
+			}
+			for name, err := range map[string]error{
+				"UpdateRecord":  s.UpdateRecord(rec("x", 1)),
+				"UpdateRecords": s.UpdateRecords([]record{rec("a", 1), rec("x", 1)}),
+				"DeleteRecord":  s.DeleteRecord("x"),
+				"DeleteRecords": s.DeleteRecords([]string{"a", "x"}),
+				"SaveInvoice":   s.SaveInvoice(1, []record{rec("b", 1), rec("x", 1)}),
+			} {
+				if err == nil {
+					t.Errorf("%s with a missing ID succeeded", name)
+				}
+			}
+			want := map[string]int64{"a": 120, "b": 60}
+			checkRecords(t, dir, backend, want)
+			// The handle itself must not hold the partial change either
+			if err := s.SaveTimer(timerState{}); err != nil {
+				t.Fatal(err)
+			}
+			checkRecords(t, dir, backend, want)
+			if n, err := s.LastInvoice(); err != nil || n != 0 {
+				t.Errorf("last invoice %d (%v) after a failed SaveInvoice, want 0", n, err)
+			}
+		})
+	}
+}
+
+func TestStoreDataVersion(t *testing.T) {
+	for _, backend := range storeBackends {
+		t.Run(backend, func(t *testing.T) {
+			dir := t.TempDir()
+			s := openTestStore(t, dir, backend)
+			if err := s.SaveTimer(timerState{}); err != nil {
+				t.Fatal(err)
+			}
+			before, err := s.DataVersion()
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Its own writes are already in memory
+			if err := s.AddRecord(record{ID: "a", ProjectID: "p", Duration: 60, StartTime: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := s.DataVersion(); v != before {
+				t.Errorf("own write changed the data version from %d to %d", before, v)
+			}
+
+			other := openTestStore(t, dir, backend)
+			if err := other.AddRecord(record{ID: "b", ProjectID: "p", Duration: 60, StartTime: time.Now()}); err != nil {
+				t.Fatal(err)
+			}
+			if v, _ := s.DataVersion(); v == before {
+				t.Error("data version unchanged after another handle wrote")
+			}
+			records, err := s.Records()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ids := recordIDs(records); !slices.Equal(ids, []string{"a", "b"}) {
+				t.Errorf("records %v after the other handle wrote, want [a b]", ids)
+			}
+		})
+	}
+}
+
+func TestPruneBackups(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, dataFileName)
+	if err := os.MkdirAll(backupDir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	first := time.Date(2024, 3, 1, 9, 0, 0, 0, time.Local)
+	var names []string
+	for i := range 8 {
+		name := backupName(path, first.Add(time.Duration(i)*time.Hour))
+		names = append(names, name)
+		if err := atomicWriteFile(filepath.Join(backupDir(path), name), []byte{byte(i)}, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := pruneBackups(path, 3); err != nil {
+		t.Fatal(err)
+	}
+
+	entries, err := os.ReadDir(backupDir(path))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var kept []string
+	for _, e := range entries {
+		kept = append(kept, e.Name())
+	}
+	// The newest three remain and no temporary files are left behind
+	if want := names[5:]; !slices.Equal(kept, want) {
+		t.Errorf("kept %v, want %v", kept, want)
+	}
+	data, err := os.ReadFile(filepath.Join(backupDir(path), names[7]))
+	if err != nil || len(data) != 1 || data[0] != 7 {
+		t.Errorf("newest backup holds %v (%v), want [7]", data, err)
+	}
+}
+
+func TestBackupInterval(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, dataFileName)
+	if err := os.WriteFile(path, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for range 3 {
+		if err := backupFile(path, 5); err != nil {
+			t.Fatal(err)
+		}
+	}
+	backups, err := listBackups(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 1 {
+		t.Fatalf("%d backups within an hour, want 1", len(backups))
+	}
+
+	old := time.Now().Add(-2 * backupInterval)
+	if err := os.Chtimes(backups[0], old, old); err != nil {
+		t.Fatal(err)
+	}
+	if !backupDue(path) {
+		t.Error("no backup due when the newest one is older than the interval")
+	}
+}
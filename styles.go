@@ -40,6 +40,11 @@ var (
 	errorStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("196")). // Red for error messages
 		Padding(0, 1)
+	summaryTitleStyle = lipgloss.NewStyle().
+		Foreground(lipgloss.Color("230")).
+		Background(lipgloss.Color("62")).
+		Padding(0, 1) // Matches the list titles
+	summaryBarStyle = lipgloss.NewStyle().Foreground(lipgloss.Color("69"))
 	totalFooterStyle = lipgloss.NewStyle().
 		Foreground(lipgloss.Color("252")).
 		Padding(1, 0).
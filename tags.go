@@ -0,0 +1,88 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// noteTagPattern finds #tags written in notes
+var noteTagPattern = regexp.MustCompile(`(?:^|\s)#([\p{L}\p{N}_-]+)`)
+
+// normalizeTag lowercases a tag and drops a leading #
+func normalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(tag), "#"))
+}
+
+// parseTags reads a list of tags separated by spaces or commas, as typed in
+// the record popups or given on the command line
+func parseTags(s string) []string {
+	var tags []string
+	for _, t := range strings.FieldsFunc(s, func(r rune) bool { return r == ',' || r == ' ' }) {
+		if t = normalizeTag(t); t != "" {
+			tags = append(tags, t)
+		}
+	}
+	return uniqueTags(tags)
+}
+
+// uniqueTags sorts tags and removes duplicates
+func uniqueTags(tags []string) []string {
+	sort.Strings(tags)
+	var unique []string
+	for i, t := range tags {
+		if i == 0 || t != tags[i-1] {
+			unique = append(unique, t)
+		}
+	}
+	return unique
+}
+
+// recordTags returns a record's tags, both from its tag field and #tags in
+// its note
+func recordTags(r record) []string {
+	tags := append([]string(nil), r.Tags...)
+	for _, m := range noteTagPattern.FindAllStringSubmatch(r.Note, -1) {
+		tags = append(tags, normalizeTag(m[1]))
+	}
+	return uniqueTags(tags)
+}
+
+// allTags lists every tag used by records
+func allTags(records []record) []string {
+	var tags []string
+	for _, r := range records {
+		tags = append(tags, recordTags(r)...)
+	}
+	return uniqueTags(tags)
+}
+
+// formatTags writes tags as "#a #b"
+func formatTags(tags []string) string {
+	if len(tags) == 0 {
+		return ""
+	}
+	return "#" + strings.Join(tags, " #")
+}
+
+// totalsByTag sums records per tag, largest first. A record counts towards
+// each of its tags, so the totals can add up to more than the records.
+func totalsByTag(records []record) []projectTotal {
+	sums := make(map[string]int64)
+	for _, r := range records {
+		for _, t := range recordTags(r) {
+			sums[t] += r.Duration
+		}
+	}
+	totals := make([]projectTotal, 0, len(sums))
+	for tag, seconds := range sums {
+		totals = append(totals, projectTotal{"#" + tag, seconds})
+	}
+	sort.Slice(totals, func(i, j int) bool {
+		if totals[i].seconds != totals[j].seconds {
+			return totals[i].seconds > totals[j].seconds
+		}
+		return totals[i].name < totals[j].name
+	})
+	return totals
+}
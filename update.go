@@ -1,6 +1,9 @@
 package main
 
 import (
+	"errors"
+	"fmt"
+	"strings"
 	"time"
 
 	tea "github.com/charmbracelet/bubbletea"
@@ -41,6 +44,24 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		if m.newLogActive {
 			return m.handleNewLogPopup(msg)
 		}
+		if m.deleteActive {
+			return m.handleDeleteProjectPopup(msg)
+		}
+		if m.exportActive {
+			return m.handleExportPopup(msg)
+		}
+		if m.customRangeActive {
+			return m.handleCustomRangePopup(msg)
+		}
+		if m.stopNoteActive {
+			return m.handleStopNotePopup(msg)
+		}
+		if m.tagFilterActive {
+			return m.handleTagFilterPopup(msg)
+		}
+		if m.rateActive {
+			return m.handleRatePopup(msg)
+		}
 		if m.helpActive {
 			m.helpActive = false
 			return m, nil
@@ -48,7 +69,6 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 
 		switch msg.String() {
 		case "q", "ctrl+c":
-			m.saveState()
 			return m, tea.Quit
 		case "tab":
 			if m.focused == "periods" {
@@ -92,29 +112,45 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				}
 			}
 		case " ":
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" {
+				// Toggle the current project in the filter
+				i := m.projectIndex(p.id)
+				m.allProjects[i].Selected = !m.allProjects[i].Selected
+				m.refreshProjects()
+				m.reportSave(m.saveProjects())
+				// Trigger immediate logs update
+				m.refreshLogs()
+			}
+		case "C":
 			if m.focused == "projects" {
-				if i := m.projects.Index(); i >= 0 {
-					items := m.projects.Items()
-					// Deselect all projects first
-					for j, it := range items {
-						if p, ok := it.(item); ok {
-							p.selected = false
-							m.projects.SetItem(j, p)
-						}
-					}
-					// Select the current one
-					if p, ok := items[i].(item); ok {
-						p.selected = true
-						m.projects.SetItem(i, p)
-						m.saveState()
-						// Trigger immediate logs update
-						logItems := make([]list.Item, len(m.filteredRecords()))
-						for i, r := range m.filteredRecords() {
-							logItems[i] = item{isRecord: true, record: r}
-						}
-						m.logs.SetItems(logItems)
-					}
+				for j := range m.allProjects {
+					m.allProjects[j].Selected = false
 				}
+				m.refreshProjects()
+				m.reportSave(m.saveProjects())
+				m.refreshLogs()
+				m.statusMessage = "Showing all projects"
+			}
+		case "N":
+			// Add a project under a client, or a task under a project
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" {
+				if p.depth+1 >= maxProjectDepth {
+					m.statusMessage = "Tasks cannot have sub-projects"
+					break
+				}
+				m.popupActive = true
+				m.newProjectParentID = p.id
+				m.projectInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
+			}
+		case "enter":
+			// Fold or unfold the project's sub-projects
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" && p.hasChildren {
+				i := m.projectIndex(p.id)
+				m.allProjects[i].Collapsed = !m.allProjects[i].Collapsed
+				m.refreshProjects()
+				m.reportSave(m.saveProjects())
 			}
 		case "n":
 			if m.focused == "projects" {
@@ -124,9 +160,10 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, textinput.Blink
 			} else if m.focused == "logs" {
 				// Pre-fill project name with selected project
-				for _, it := range m.projects.Items() {
-					if p, ok := it.(item); ok && p.selected {
-						m.newLogProjectInput.SetValue(p.name)
+				paths := projectPaths(m.allProjects)
+				for _, p := range m.allProjects {
+					if p.Selected {
+						m.newLogProjectInput.SetValue(paths[p.ID])
 						break
 					}
 				}
@@ -136,100 +173,217 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 				return m, textinput.Blink
 			}
 		case "d":
-			if m.focused == "projects" && len(m.projects.Items()) > 1 {
-				if i := m.projects.Index(); i >= 0 {
-					m.projects.RemoveItem(i)
-					if i >= len(m.projects.Items()) && len(m.projects.Items()) > 0 {
-						m.projects.Select(0)
-						// Trigger immediate logs update
-						logItems := make([]list.Item, len(m.filteredRecords()))
-						for i, r := range m.filteredRecords() {
-							logItems[i] = item{isRecord: true, record: r}
-						}
-						m.logs.SetItems(logItems)
-					}
-					if m.timerRunning {
-						if p, ok := m.projects.SelectedItem().(item); !ok || p.name != m.timerProject {
-							m.timerRunning = false
-							m.timerProject = ""
-						}
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" && p.hasChildren {
+				m.statusMessage = p.name + " has sub-projects, delete or archive those first"
+			} else if ok && m.focused == "projects" && len(m.allProjects) > 1 {
+				// Ask before deleting, the project's records need a decision
+				m.deleteActive = true
+				m.deleteProjectID = p.id
+				m.errorMessage = ""
+				return m, nil
+			} else if m.focused == "logs" && m.logsView == "" {
+				if r, ok := m.logs.SelectedItem().(item); ok && r.isRecord {
+					m.checkpoint("delete record " + m.describeRecord(r.record))
+					i := m.logs.Index()
+					if j := m.recordIndex(r.record.ID); j >= 0 {
+						m.records = append(m.records[:j], m.records[j+1:]...)
 					}
-					m.saveState()
-				}
-			} else if m.focused == "logs" && m.logs.Index() >= 0 && len(m.records) > 0 {
-				i := m.logs.Index()
-				if i < len(m.logs.Items()) {
-					m.records = append(m.records[:i], m.records[i+1:]...)
 					m.logs.RemoveItem(i)
 					if len(m.logs.Items()) == 0 {
 						m.logs.Select(-1)
 					} else if i >= len(m.logs.Items()) {
 						m.logs.Select(len(m.logs.Items()) - 1)
 					}
-					m.saveState()
+					m.reportSave(m.store.DeleteRecord(r.record.ID))
+				}
+			}
+		case "a":
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" {
+				if p.archived {
+					m.checkpoint("restore " + p.name)
+				} else {
+					m.checkpoint("archive " + p.name)
+				}
+				i := m.projectIndex(p.id)
+				m.allProjects[i].Archived = !p.archived
+				if m.allProjects[i].Archived {
+					m.allProjects[i].Selected = false
+					m.statusMessage = "Archived " + p.name
+				} else {
+					m.statusMessage = "Restored " + p.name
 				}
+				m.refreshProjects()
+				m.reportSave(m.saveProjects())
+				m.refreshLogs()
+			}
+		case "A":
+			if m.focused == "projects" {
+				m.showArchived = !m.showArchived
+				m.refreshProjects()
+			}
+		case "r":
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" {
+				m.popupActive = true
+				m.renamingProjectID = p.id
+				m.projectInput.SetValue(p.name)
+				m.projectInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
 			}
 		case "e":
-			if m.focused == "logs" && m.logs.Index() >= 0 && m.logs.Index() < len(m.records) {
+			if r, ok := m.logs.SelectedItem().(item); ok && m.focused == "logs" && m.logsView == "" && r.isRecord {
 				m.recordEditActive = true
-				m.recordStartInput.SetValue(m.records[m.logs.Index()].StartTime.Format("2006-01-02 15:04:05"))
-				m.recordDurationInput.SetValue(formatDuration(m.records[m.logs.Index()].Duration))
-				m.newLogProjectInput.SetValue(m.records[m.logs.Index()].Project)
+				m.editingRecordID = r.record.ID
+				m.recordStartInput.SetValue(r.record.StartTime.Format("2006-01-02 15:04:05"))
+				m.recordDurationInput.SetValue(formatDuration(r.record.Duration))
+				m.newLogProjectInput.SetValue(r.name)
+				m.noteInput.SetValue(r.record.Note)
+				m.tagsInput.SetValue(strings.Join(r.record.Tags, " "))
 				m.newLogProjectInput.Focus()
 				m.errorMessage = ""
 				return m, textinput.Blink
 			}
+		case "$":
+			if p, ok := m.projects.SelectedItem().(item); ok && m.focused == "projects" {
+				m.rateActive = true
+				m.rateProjectID = p.id
+				if i := m.projectIndex(p.id); i >= 0 && m.allProjects[i].Rate > 0 {
+					own := m.allProjects[i]
+					m.rateInput.SetValue(strings.TrimSpace(fmt.Sprintf("%g %s", own.Rate, own.Currency)))
+				}
+				m.rateInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
+			}
+		case "b":
+			if r, ok := m.logs.SelectedItem().(item); ok && m.focused == "logs" && m.logsView == "" && r.isRecord {
+				if i := m.recordIndex(r.record.ID); i >= 0 {
+					m.checkpoint("toggle billable " + m.describeRecord(r.record))
+					m.records[i].NonBillable = !m.records[i].NonBillable
+					m.reportSave(m.store.UpdateRecord(m.records[i]))
+					m.refreshLogs()
+					if m.records[i].NonBillable {
+						m.statusMessage = "Marked non-billable"
+					} else {
+						m.statusMessage = "Marked billable"
+					}
+				}
+			}
+		case "x":
+			if m.focused == "logs" {
+				m.exportActive = true
+				m.exportFormatInput.SetValue("csv")
+				m.exportFormatInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
+			}
+		case "c":
+			if m.focused == "periods" {
+				if !m.customFrom.IsZero() {
+					m.customFromInput.SetValue(m.customFrom.Format("2006-01-02"))
+				}
+				if !m.customTo.IsZero() {
+					m.customToInput.SetValue(m.customTo.AddDate(0, 0, -1).Format("2006-01-02"))
+				}
+				m.customRangeActive = true
+				m.customFromInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
+			}
+		case "[", "]":
+			// Only ranges with a start can be stepped; "All" has none
+			if from, _ := m.periodRange(); from.IsZero() {
+				break
+			}
+			if msg.String() == "[" {
+				m.periodOffset--
+			} else {
+				m.periodOffset++
+			}
+			m.refreshLogs()
+		case "v":
+			if m.focused == "logs" {
+				switch m.logsView {
+				case "":
+					m.logsView = "summary"
+				case "summary":
+					m.logsView = "chart"
+				default:
+					m.logsView = ""
+				}
+			}
+		case "t":
+			var tags []string
+			for t := range m.tagFilter {
+				tags = append(tags, t)
+			}
+			m.tagFilterInput.SetValue(strings.Join(uniqueTags(tags), " "))
+			m.tagFilterActive = true
+			m.tagFilterInput.Focus()
+			return m, textinput.Blink
 		case "?":
 			m.helpActive = true
 			return m, nil
+		case "u":
+			m.undo()
+		case "ctrl+r":
+			m.redo()
 		case "s":
 			if m.timerRunning {
+				m.checkpoint("stop timer")
 				duration := int64(time.Since(m.timerStart).Seconds())
 				m.records = append(m.records, record{
-					Project:   m.timerProject,
+					ID:        newID(),
+					ProjectID: m.timerProjectID,
 					Duration:  duration,
 					StartTime: m.timerStart,
 				})
-				m.logs.InsertItem(len(m.logs.Items()), item{isRecord: true, record: m.records[len(m.records)-1]})
+				m.logs.InsertItem(len(m.logs.Items()), recordItem(m.records[len(m.records)-1], projectPaths(m.allProjects)))
 				m.timerRunning = false
-				m.timerProject = ""
-				m.saveState()
+				m.timerProjectID = ""
+				m.reportSave(m.store.StopTimer(m.records[len(m.records)-1], timerState{Start: m.timerStart}))
+				// Ask what the session was for, Esc leaves it without a note
+				m.stopNoteActive = true
+				m.stopNoteRecordID = m.records[len(m.records)-1].ID
+				m.noteInput.Focus()
+				m.errorMessage = ""
+				return m, textinput.Blink
 			} else {
-				// Start timer for the single selected project
-				for _, it := range m.projects.Items() {
-					if p, ok := it.(item); ok && p.selected {
-						m.timerRunning = true
-						m.timerStart = time.Now()
-						m.timerProject = p.name
-						m.saveState()
-						break
-					}
+				// Start timer for the project under the cursor, independent of
+				// which projects are selected for filtering
+				if p, ok := m.projects.SelectedItem().(item); ok && !p.archived {
+					m.checkpoint("start timer for " + p.name)
+					m.timerRunning = true
+					m.timerStart = time.Now()
+					m.timerProjectID = p.id
+					m.statusMessage = "Started " + p.name
+					m.reportSave(m.saveTimer())
 				}
 			}
 		}
 	case tickMsg:
+		m.syncStore()
 		// Only update logs if necessary
 		filtered := m.filteredRecords()
 		if len(m.logs.Items()) != len(filtered) {
+			paths := projectPaths(m.allProjects)
 			logItems := make([]list.Item, len(filtered))
 			for i, r := range filtered {
-				logItems[i] = item{isRecord: true, record: r}
+				logItems[i] = recordItem(r, paths)
 			}
 			m.logs.SetItems(logItems)
 		}
 		return m, tea.Tick(100*time.Millisecond, func(t time.Time) tea.Msg { return tickMsg{} })
 	}
 
-	// Update periods and trigger logs update if selection changes
+	// Update periods and trigger logs and project totals update if selection
+	// changes
 	if m.focused == "periods" {
 		prevIndex := m.periods.Index()
 		m.periods, cmd = m.periods.Update(msg)
 		if m.periods.Index() != prevIndex {
-			logItems := make([]list.Item, len(m.filteredRecords()))
-			for i, r := range m.filteredRecords() {
-				logItems[i] = item{isRecord: true, record: r}
-			}
-			m.logs.SetItems(logItems)
+			m.periodOffset = 0
+			m.refreshLogs()
 		}
 	} else if m.focused == "projects" {
 		m.projects, cmd = m.projects.Update(msg)
@@ -244,24 +398,43 @@ func (m model) handleProjectPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	switch msg.String() {
 	case "enter":
 		name := m.projectInput.Value()
-		if name == "" {
-			m.errorMessage = "Project name cannot be empty"
+		parentID := m.newProjectParentID
+		if i := m.projectIndex(m.renamingProjectID); i >= 0 {
+			parentID = m.allProjects[i].ParentID
+		}
+		if errMsg := m.validateProjectName(name, m.renamingProjectID, parentID); errMsg != "" {
+			m.errorMessage = errMsg
 			return m, nil
 		}
-		for _, it := range m.projects.Items() {
-			if p, ok := it.(item); ok && p.name == name {
-				m.errorMessage = "Project name already exists"
-				return m, nil
+		if m.renamingProjectID != "" {
+			if i := m.projectIndex(m.renamingProjectID); i >= 0 {
+				m.checkpoint(fmt.Sprintf("rename %s to %s", m.allProjects[i].Name, name))
+			}
+			// Records link to the project by ID, so renaming the project
+			// carries its whole history over
+			if i := m.projectIndex(m.renamingProjectID); i >= 0 {
+				m.allProjects[i].Name = name
+			}
+			m.refreshLogs()
+		} else {
+			m.checkpoint("add project " + name)
+			m.allProjects = append(m.allProjects, projectEntry{ID: newID(), Name: name, ParentID: parentID})
+			// Show the new project under its parent
+			if i := m.projectIndex(parentID); i >= 0 {
+				m.allProjects[i].Collapsed = false
 			}
 		}
-		newProject := item{name: name}
-		m.projects.InsertItem(len(m.projects.Items()), newProject)
-		m.saveState()
+		m.refreshProjects()
+		m.reportSave(m.saveProjects())
 		m.popupActive = false
+		m.renamingProjectID = ""
+		m.newProjectParentID = ""
 		m.projectInput.Reset()
 		m.errorMessage = ""
 	case "esc":
 		m.popupActive = false
+		m.renamingProjectID = ""
+		m.newProjectParentID = ""
 		m.projectInput.Reset()
 		m.errorMessage = ""
 	default:
@@ -274,7 +447,7 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 	var cmd tea.Cmd
 	switch msg.String() {
 	case "enter":
-		if i := m.logs.Index(); i >= 0 && i < len(m.records) {
+		if i := m.recordIndex(m.editingRecordID); i >= 0 {
 			project := m.newLogProjectInput.Value()
 			startTime, err1 := time.Parse("2006-01-02 15:04:05", m.recordStartInput.Value())
 			duration, err2 := parseDuration(m.recordDurationInput.Value())
@@ -290,20 +463,23 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 				m.errorMessage = "Invalid duration format (use hh:mm:ss, non-negative, minutes/seconds <= 59)"
 				return m, nil
 			}
-			for _, it := range m.projects.Items() {
-				if p, ok := it.(item); ok && p.name == project {
-					m.records[i].Project = project
-					m.records[i].StartTime = startTime
-					m.records[i].Duration = duration
-					m.logs.SetItem(i, item{isRecord: true, record: m.records[i]})
-					m.saveState()
-					m.recordEditActive = false
-					m.newLogProjectInput.Reset()
-					m.recordStartInput.Reset()
-					m.recordDurationInput.Reset()
-					m.errorMessage = ""
-					return m, nil
-				}
+			if p, ok := m.projectByName(project); ok {
+				m.checkpoint("edit record " + m.describeRecord(m.records[i]))
+				m.records[i].ProjectID = p.ID
+				m.records[i].StartTime = startTime
+				m.records[i].Duration = duration
+				m.records[i].Note = strings.TrimSpace(m.noteInput.Value())
+				m.records[i].Tags = parseTags(m.tagsInput.Value())
+				m.logs.SetItem(m.logs.Index(), recordItem(m.records[i], projectPaths(m.allProjects)))
+				m.reportSave(m.store.UpdateRecord(m.records[i]))
+				m.recordEditActive = false
+				m.newLogProjectInput.Reset()
+				m.recordStartInput.Reset()
+				m.recordDurationInput.Reset()
+				m.noteInput.Reset()
+				m.tagsInput.Reset()
+				m.errorMessage = ""
+				return m, nil
 			}
 			m.errorMessage = "Project does not exist"
 			return m, nil
@@ -313,6 +489,8 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.newLogProjectInput.Reset()
 		m.recordStartInput.Reset()
 		m.recordDurationInput.Reset()
+		m.noteInput.Reset()
+		m.tagsInput.Reset()
 		m.errorMessage = ""
 	case "tab":
 		if m.newLogProjectInput.Focused() {
@@ -321,13 +499,25 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		} else if m.recordStartInput.Focused() {
 			m.recordStartInput.Blur()
 			m.recordDurationInput.Focus()
-		} else {
+		} else if m.recordDurationInput.Focused() {
 			m.recordDurationInput.Blur()
+			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
+			m.noteInput.Blur()
+			m.tagsInput.Focus()
+		} else {
+			m.tagsInput.Blur()
 			m.newLogProjectInput.Focus()
 		}
 		return m, textinput.Blink
 	case "shift+tab":
-		if m.recordDurationInput.Focused() {
+		if m.tagsInput.Focused() {
+			m.tagsInput.Blur()
+			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
+			m.noteInput.Blur()
+			m.recordDurationInput.Focus()
+		} else if m.recordDurationInput.Focused() {
 			m.recordDurationInput.Blur()
 			m.recordStartInput.Focus()
 		} else if m.recordStartInput.Focused() {
@@ -335,7 +525,7 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.newLogProjectInput.Focus()
 		} else {
 			m.newLogProjectInput.Blur()
-			m.recordDurationInput.Focus()
+			m.tagsInput.Focus()
 		}
 		return m, textinput.Blink
 	default:
@@ -343,8 +533,12 @@ func (m model) handleRecordEditPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.newLogProjectInput, cmd = m.newLogProjectInput.Update(msg)
 		} else if m.recordStartInput.Focused() {
 			m.recordStartInput, cmd = m.recordStartInput.Update(msg)
-		} else {
+		} else if m.recordDurationInput.Focused() {
 			m.recordDurationInput, cmd = m.recordDurationInput.Update(msg)
+		} else if m.noteInput.Focused() {
+			m.noteInput, cmd = m.noteInput.Update(msg)
+		} else {
+			m.tagsInput, cmd = m.tagsInput.Update(msg)
 		}
 	}
 	return m, cmd
@@ -369,24 +563,28 @@ func (m model) handleNewLogPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.errorMessage = "Invalid duration format (use hh:mm:ss, non-negative, minutes/seconds <= 59)"
 			return m, nil
 		}
-		// Validate project exists
-		for _, it := range m.projects.Items() {
-			if p, ok := it.(item); ok && p.name == project {
-				newRecord := record{
-					Project:   project,
-					Duration:  duration,
-					StartTime: startTime,
-				}
-				m.records = append(m.records, newRecord)
-				m.logs.InsertItem(len(m.logs.Items()), item{isRecord: true, record: newRecord})
-				m.saveState()
-				m.newLogActive = false
-				m.newLogProjectInput.Reset()
-				m.newLogStartInput.Reset()
-				m.newLogDurationInput.Reset()
-				m.errorMessage = ""
-				return m, nil
+		// Validate project exists, by path or unambiguous name
+		if p, ok := m.projectByName(project); ok {
+			newRecord := record{
+				ID:        newID(),
+				ProjectID: p.ID,
+				Duration:  duration,
+				StartTime: startTime,
+				Note:      strings.TrimSpace(m.noteInput.Value()),
+				Tags:      parseTags(m.tagsInput.Value()),
 			}
+			m.checkpoint("add record " + m.describeRecord(newRecord))
+			m.records = append(m.records, newRecord)
+			m.logs.InsertItem(len(m.logs.Items()), recordItem(newRecord, projectPaths(m.allProjects)))
+			m.reportSave(m.store.AddRecord(newRecord))
+			m.newLogActive = false
+			m.newLogProjectInput.Reset()
+			m.newLogStartInput.Reset()
+			m.newLogDurationInput.Reset()
+			m.noteInput.Reset()
+			m.tagsInput.Reset()
+			m.errorMessage = ""
+			return m, nil
 		}
 		m.errorMessage = "Project does not exist"
 		return m, nil
@@ -395,6 +593,8 @@ func (m model) handleNewLogPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		m.newLogProjectInput.Reset()
 		m.newLogStartInput.Reset()
 		m.newLogDurationInput.Reset()
+		m.noteInput.Reset()
+		m.tagsInput.Reset()
 		m.errorMessage = ""
 	case "tab":
 		if m.newLogProjectInput.Focused() {
@@ -403,13 +603,25 @@ func (m model) handleNewLogPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		} else if m.newLogStartInput.Focused() {
 			m.newLogStartInput.Blur()
 			m.newLogDurationInput.Focus()
-		} else {
+		} else if m.newLogDurationInput.Focused() {
 			m.newLogDurationInput.Blur()
+			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
+			m.noteInput.Blur()
+			m.tagsInput.Focus()
+		} else {
+			m.tagsInput.Blur()
 			m.newLogProjectInput.Focus()
 		}
 		return m, textinput.Blink
 	case "shift+tab":
-		if m.newLogDurationInput.Focused() {
+		if m.tagsInput.Focused() {
+			m.tagsInput.Blur()
+			m.noteInput.Focus()
+		} else if m.noteInput.Focused() {
+			m.noteInput.Blur()
+			m.newLogDurationInput.Focus()
+		} else if m.newLogDurationInput.Focused() {
 			m.newLogDurationInput.Blur()
 			m.newLogStartInput.Focus()
 		} else if m.newLogStartInput.Focused() {
@@ -417,7 +629,7 @@ func (m model) handleNewLogPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.newLogProjectInput.Focus()
 		} else {
 			m.newLogProjectInput.Blur()
-			m.newLogDurationInput.Focus()
+			m.tagsInput.Focus()
 		}
 		return m, textinput.Blink
 	default:
@@ -425,9 +637,304 @@ func (m model) handleNewLogPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 			m.newLogProjectInput, cmd = m.newLogProjectInput.Update(msg)
 		} else if m.newLogStartInput.Focused() {
 			m.newLogStartInput, cmd = m.newLogStartInput.Update(msg)
-		} else {
+		} else if m.newLogDurationInput.Focused() {
 			m.newLogDurationInput, cmd = m.newLogDurationInput.Update(msg)
+		} else if m.noteInput.Focused() {
+			m.noteInput, cmd = m.noteInput.Update(msg)
+		} else {
+			m.tagsInput, cmd = m.tagsInput.Update(msg)
 		}
 	}
 	return m, cmd
 }
+
+func (m model) handleDeleteProjectPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	if m.reassigning {
+		switch msg.String() {
+		case "enter":
+			target, ok := m.projectByName(m.reassignInput.Value())
+			if !ok {
+				m.errorMessage = "Project does not exist"
+				return m, nil
+			}
+			if target.ID == m.deleteProjectID {
+				m.errorMessage = "Pick a different project"
+				return m, nil
+			}
+			return m.deleteProject(target.ID), nil
+		case "esc":
+			m.reassigning = false
+			m.reassignInput.Reset()
+			m.errorMessage = ""
+		default:
+			m.reassignInput, cmd = m.reassignInput.Update(msg)
+		}
+		return m, cmd
+	}
+
+	switch msg.String() {
+	case "y":
+		return m.deleteProject(""), nil
+	case "r":
+		if m.projectRecordCount(m.deleteProjectID) > 0 {
+			m.reassigning = true
+			m.reassignInput.Focus()
+			m.errorMessage = ""
+			return m, textinput.Blink
+		}
+	case "a":
+		if i := m.projectIndex(m.deleteProjectID); i >= 0 {
+			m.checkpoint("archive " + m.allProjects[i].Name)
+			m.allProjects[i].Archived = true
+			m.allProjects[i].Selected = false
+			m.statusMessage = "Archived " + m.allProjects[i].Name
+			m.refreshProjects()
+			m.reportSave(m.saveProjects())
+			m.refreshLogs()
+		}
+		m.deleteActive = false
+		m.deleteProjectID = ""
+	case "esc", "n":
+		m.deleteActive = false
+		m.deleteProjectID = ""
+		m.errorMessage = ""
+	}
+	return m, nil
+}
+
+// deleteProject removes the project awaiting confirmation. Its records move to
+// the project reassignTo, or are deleted with it when reassignTo is empty.
+func (m model) deleteProject(reassignTo string) model {
+	i := m.projectIndex(m.deleteProjectID)
+	if i < 0 {
+		m.deleteActive = false
+		return m
+	}
+	deleted := m.allProjects[i]
+	m.checkpoint("delete project " + deleted.Name)
+	m.allProjects = append(m.allProjects[:i], m.allProjects[i+1:]...)
+
+	var moved []record
+	var dropped []string
+	kept := m.records[:0]
+	for _, r := range m.records {
+		if r.ProjectID != deleted.ID {
+			kept = append(kept, r)
+			continue
+		}
+		if reassignTo != "" {
+			r.ProjectID = reassignTo
+			moved = append(moved, r)
+			kept = append(kept, r)
+		} else {
+			dropped = append(dropped, r.ID)
+		}
+	}
+	m.records = kept
+
+	// One write per kind of change, so a failure cannot leave the records
+	// half moved
+	var errs []error
+	if len(moved) > 0 {
+		errs = append(errs, m.store.UpdateRecords(moved))
+	}
+	if len(dropped) > 0 {
+		errs = append(errs, m.store.DeleteRecords(dropped))
+	}
+	// A running session goes where the records go
+	if m.timerRunning && deleted.ID == m.timerProjectID {
+		m.timerProjectID = reassignTo
+		m.timerRunning = reassignTo != ""
+		errs = append(errs, m.saveTimer())
+	}
+	errs = append(errs, m.saveProjects())
+	m.reportSave(errors.Join(errs...))
+	m.statusMessage = "Deleted " + deleted.Name
+
+	m.refreshProjects()
+	m.refreshLogs()
+	m.deleteActive = false
+	m.deleteProjectID = ""
+	m.reassigning = false
+	m.reassignInput.Reset()
+	m.errorMessage = ""
+	return m
+}
+
+func (m model) handleExportPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		format := m.exportFormatInput.Value()
+		if _, ok := exporters[format]; !ok {
+			m.errorMessage = "Unknown format (use " + exportFormats() + ")"
+			return m, nil
+		}
+		path := m.exportPathInput.Value()
+		if path == "" {
+			path = defaultExportPath(format, time.Now())
+		}
+		records := m.filteredRecords()
+		if err := exportRecords(nil, path, format, records, projectPaths(m.allProjects)); err != nil {
+			m.errorMessage = err.Error()
+			return m, nil
+		}
+		m.statusMessage = fmt.Sprintf("Exported %d records to %s", len(records), path)
+		m.exportActive = false
+		m.exportFormatInput.Reset()
+		m.exportPathInput.Reset()
+		m.errorMessage = ""
+	case "esc":
+		m.exportActive = false
+		m.exportFormatInput.Reset()
+		m.exportPathInput.Reset()
+		m.errorMessage = ""
+	case "tab", "shift+tab":
+		if m.exportFormatInput.Focused() {
+			m.exportFormatInput.Blur()
+			m.exportPathInput.Focus()
+		} else {
+			m.exportPathInput.Blur()
+			m.exportFormatInput.Focus()
+		}
+		return m, textinput.Blink
+	default:
+		if m.exportFormatInput.Focused() {
+			m.exportFormatInput, cmd = m.exportFormatInput.Update(msg)
+		} else {
+			m.exportPathInput, cmd = m.exportPathInput.Update(msg)
+		}
+	}
+	return m, cmd
+}
+
+func (m model) handleCustomRangePopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		var from, to time.Time
+		if v := strings.TrimSpace(m.customFromInput.Value()); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				m.errorMessage = "Invalid from date (use YYYY-MM-DD)"
+				return m, nil
+			}
+			from = t
+		}
+		if v := strings.TrimSpace(m.customToInput.Value()); v != "" {
+			t, err := time.ParseInLocation("2006-01-02", v, time.Local)
+			if err != nil {
+				m.errorMessage = "Invalid to date (use YYYY-MM-DD)"
+				return m, nil
+			}
+			to = t.AddDate(0, 0, 1)
+		}
+		if !from.IsZero() && !to.IsZero() && !from.Before(to) {
+			m.errorMessage = "From date is after to date"
+			return m, nil
+		}
+		m.customFrom, m.customTo = from, to
+		m.periodOffset = 0
+		m.periods.Select(len(m.periods.Items()) - 1)
+		m.refreshLogs()
+		m.customRangeActive = false
+		m.customFromInput.Reset()
+		m.customToInput.Reset()
+		m.errorMessage = ""
+	case "esc":
+		m.customRangeActive = false
+		m.customFromInput.Reset()
+		m.customToInput.Reset()
+		m.errorMessage = ""
+	case "tab", "shift+tab":
+		if m.customFromInput.Focused() {
+			m.customFromInput.Blur()
+			m.customToInput.Focus()
+		} else {
+			m.customToInput.Blur()
+			m.customFromInput.Focus()
+		}
+		return m, textinput.Blink
+	default:
+		if m.customFromInput.Focused() {
+			m.customFromInput, cmd = m.customFromInput.Update(msg)
+		} else {
+			m.customToInput, cmd = m.customToInput.Update(msg)
+		}
+	}
+	return m, cmd
+}
+
+// handleStopNotePopup adds an optional note to the record the timer just
+// created. It belongs to the same undo step as stopping the timer.
+func (m model) handleStopNotePopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		note := strings.TrimSpace(m.noteInput.Value())
+		if i := m.recordIndex(m.stopNoteRecordID); i >= 0 && note != "" {
+			m.records[i].Note = note
+			m.reportSave(m.store.UpdateRecord(m.records[i]))
+			m.refreshLogs()
+		}
+		m.stopNoteActive = false
+		m.noteInput.Reset()
+	case "esc":
+		m.stopNoteActive = false
+		m.noteInput.Reset()
+	default:
+		m.noteInput, cmd = m.noteInput.Update(msg)
+	}
+	return m, cmd
+}
+
+// handleRatePopup sets the hourly rate and currency of a project, or clears
+// them so the parent's apply
+func (m model) handleRatePopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		rate, currency, err := parseRate(m.rateInput.Value())
+		if err != nil {
+			m.errorMessage = err.Error()
+			return m, nil
+		}
+		if i := m.projectIndex(m.rateProjectID); i >= 0 {
+			m.checkpoint("set rate of " + m.allProjects[i].Name)
+			m.allProjects[i].Rate = rate
+			m.allProjects[i].Currency = currency
+			m.reportSave(m.saveProjects())
+			m.refreshLogs()
+		}
+		m.rateActive = false
+		m.rateInput.Reset()
+		m.errorMessage = ""
+	case "esc":
+		m.rateActive = false
+		m.rateInput.Reset()
+		m.errorMessage = ""
+	default:
+		m.rateInput, cmd = m.rateInput.Update(msg)
+	}
+	return m, cmd
+}
+
+// handleTagFilterPopup narrows the logs to records with any of the typed
+// tags
+func (m model) handleTagFilterPopup(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	var cmd tea.Cmd
+	switch msg.String() {
+	case "enter":
+		m.tagFilter = tagFilter([]string{m.tagFilterInput.Value()})
+		m.refreshLogs()
+		m.tagFilterActive = false
+		m.tagFilterInput.Reset()
+	case "esc":
+		m.tagFilterActive = false
+		m.tagFilterInput.Reset()
+	default:
+		m.tagFilterInput, cmd = m.tagFilterInput.Update(msg)
+	}
+	return m, cmd
+}
@@ -2,6 +2,8 @@ package main
 
 import (
 	"fmt"
+	"slices"
+	"strings"
 	"time"
 )
 
@@ -28,67 +30,224 @@ func parseDuration(input string) (int64, error) {
 }
 
 // Helper to format record item title
-func formatItemTitle(r record) string {
-	return fmt.Sprintf("%s - %s @ %s", r.Project, formatDuration(r.Duration), r.StartTime.Format("2006-01-02 15:04:05"))
+func formatItemTitle(r record, project string) string {
+	title := fmt.Sprintf("%s - %s @ %s", project, formatDuration(r.Duration), r.StartTime.Format("2006-01-02 15:04:05"))
+	if r.Note != "" {
+		title += " - " + r.Note
+	}
+	if len(r.Tags) > 0 {
+		title += " " + formatTags(r.Tags)
+	}
+	if r.NonBillable {
+		title += " (non-billable)"
+	}
+	if r.Invoice != "" {
+		title += " (invoice " + r.Invoice + ")"
+	}
+	return title
 }
 
-func (m model) filteredRecords() []record {
-	now := time.Now()
-	var period string
-	if sel := m.periods.SelectedItem(); sel != nil {
-		if p, ok := sel.(item); ok {
-			period = p.name
-		} else {
-			period = "All"
-		}
-	} else {
-		period = "All"
-	}
+// recordFilter narrows records down for the logs pane, reports and exports
+type recordFilter struct {
+	From       time.Time       // Inclusive, zero for no lower bound
+	To         time.Time       // Exclusive, zero for no upper bound
+	ProjectIDs map[string]bool // Only these projects, nil for all
+	Tags       map[string]bool // Only records with any of these tags, nil for all
+}
 
-	// Cache selected project
-	var selectedProject string
+// filterRecords returns the records of existing projects that match f
+func filterRecords(records []record, projects []projectEntry, f recordFilter) []record {
 	projectMap := make(map[string]bool)
-	for _, it := range m.projects.Items() {
-		if p, ok := it.(item); ok {
-			projectMap[p.name] = true
-			if p.selected {
-				selectedProject = p.name
-			}
-		}
+	for _, p := range projects {
+		projectMap[p.ID] = true
 	}
 
 	var filtered []record
-	for _, r := range m.records {
-		// Filter by selected project
-		if selectedProject != "" && r.Project != selectedProject {
+	for _, r := range records {
+		// Filter by selected projects
+		if f.ProjectIDs != nil && !f.ProjectIDs[r.ProjectID] {
 			continue
 		}
 		// Verify project exists
-		if !projectMap[r.Project] {
+		if !projectMap[r.ProjectID] {
+			continue
+		}
+		if f.Tags != nil && !slices.ContainsFunc(recordTags(r), func(t string) bool { return f.Tags[t] }) {
 			continue
 		}
-		// Filter by period
-		if period != "All" {
-			var maxAge time.Duration
-			switch period {
-			case "Year":
-				maxAge = 365 * 24 * time.Hour
-			case "Month":
-				maxAge = 30 * 24 * time.Hour
-			case "Week":
-				maxAge = 7 * 24 * time.Hour
-			case "Day":
-				maxAge = 24 * time.Hour
-			}
-			if now.Sub(r.StartTime) > maxAge {
-				continue
-			}
+		// Filter by time range
+		if !f.From.IsZero() && r.StartTime.Before(f.From) {
+			continue
+		}
+		if !f.To.IsZero() && !r.StartTime.Before(f.To) {
+			continue
 		}
 		filtered = append(filtered, r)
 	}
 	return filtered
 }
 
+// periodNames are the entries of the Period pane. The calendar periods start
+// at local midnight; the "Last" ones are rolling windows.
+var periodNames = []string{
+	"All",
+	"Today",
+	"This week",
+	"This month",
+	"This year",
+	"Last 7 days",
+	"Last 30 days",
+	"Last 365 days",
+}
+
+// weekStartEnvVar sets the first day of the week when --week-start is unset
+const weekStartEnvVar = "FISHTIME_WEEK_START"
+
+// weekStart is the first day of "This week", set from --week-start
+var weekStart = time.Monday
+
+// parseWeekday accepts a weekday name such as "monday" or "sun"
+func parseWeekday(s string) (time.Weekday, error) {
+	s = strings.ToLower(strings.TrimSpace(s))
+	for d := time.Sunday; d <= time.Saturday; d++ {
+		name := strings.ToLower(d.String())
+		if s == name || (len(s) >= 3 && strings.HasPrefix(name, s)) {
+			return d, nil
+		}
+	}
+	return 0, fmt.Errorf("invalid week start %q (use a weekday such as monday or sunday)", s)
+}
+
+// lookupPeriod returns the Period pane entry matching name, ignoring case
+func lookupPeriod(name string) (string, bool) {
+	for _, p := range periodNames {
+		if strings.EqualFold(p, name) {
+			return p, true
+		}
+	}
+	return "", false
+}
+
+// periodStart returns when a Period pane entry begins, zero for "All"
+func periodStart(period string, now time.Time) time.Time {
+	now = now.Local()
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	switch period {
+	case "Today":
+		return midnight
+	case "This week":
+		return midnight.AddDate(0, 0, -(int(now.Weekday()-weekStart)+7)%7)
+	case "This month":
+		return time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	case "This year":
+		return time.Date(now.Year(), 1, 1, 0, 0, 0, 0, time.Local)
+	case "Last 7 days":
+		return now.AddDate(0, 0, -7)
+	case "Last 30 days":
+		return now.AddDate(0, 0, -30)
+	case "Last 365 days":
+		return now.AddDate(0, 0, -365)
+	}
+	return time.Time{}
+}
+
+// customPeriod is the Period pane entry whose range is picked in a popup
+const customPeriod = "Custom range"
+
+// periodRange returns the range of a Period pane entry moved offset periods
+// back (negative) or forward. A zero time leaves that side open.
+func periodRange(period string, now time.Time, offset int) (from, to time.Time) {
+	start := periodStart(period, now)
+	switch period {
+	case "Today":
+		return start.AddDate(0, 0, offset), start.AddDate(0, 0, offset+1)
+	case "This week":
+		return start.AddDate(0, 0, 7*offset), start.AddDate(0, 0, 7*offset+7)
+	case "This month":
+		return start.AddDate(0, offset, 0), start.AddDate(0, offset+1, 0)
+	case "This year":
+		return start.AddDate(offset, 0, 0), start.AddDate(offset+1, 0, 0)
+	}
+	var days int
+	if _, err := fmt.Sscanf(period, "Last %d days", &days); err == nil && offset != 0 {
+		return start.AddDate(0, 0, days*offset), now.AddDate(0, 0, days*offset)
+	}
+	return start, time.Time{}
+}
+
+// describeRange names a date range for the Period pane title
+func describeRange(from, to time.Time) string {
+	const layout = "2006-01-02"
+	switch {
+	case from.IsZero() && to.IsZero():
+		return "any time"
+	case to.IsZero():
+		return "from " + from.Format(layout)
+	case from.IsZero():
+		return "until " + to.Add(-time.Nanosecond).Format(layout)
+	}
+	last := to.Add(-time.Nanosecond).Format(layout)
+	if from.Format(layout) == last {
+		return last
+	}
+	return from.Format(layout) + " – " + last
+}
+
+// periodRange returns the range picked in the Period pane, including
+// stepping with [ and ] and a custom range
+func (m model) periodRange() (from, to time.Time) {
+	period := "All"
+	if p, ok := m.periods.SelectedItem().(item); ok {
+		period = p.name
+	}
+	if period != customPeriod {
+		return periodRange(period, time.Now(), m.periodOffset)
+	}
+	if m.customFrom.IsZero() || m.customTo.IsZero() {
+		return m.customFrom, m.customTo
+	}
+	// Step custom ranges by their own length in days
+	days := int(m.customTo.Sub(m.customFrom).Round(24*time.Hour) / (24 * time.Hour))
+	return m.customFrom.AddDate(0, 0, days*m.periodOffset), m.customTo.AddDate(0, 0, days*m.periodOffset)
+}
+
+// periodTitle shows the picked range when it is not obvious from the entry
+func (m model) periodTitle() string {
+	p, _ := m.periods.SelectedItem().(item)
+	if m.periodOffset == 0 && p.name != customPeriod {
+		return "Period"
+	}
+	return "Period: " + describeRange(m.periodRange())
+}
+
+func (m model) filteredRecords() []record {
+	f := recordFilter{Tags: m.tagFilter}
+	f.From, f.To = m.periodRange()
+	// Selected projects, with everything below them, narrow the logs; none
+	// selected shows every project
+	selected := make(map[string]bool)
+	for _, p := range m.allProjects {
+		if p.Selected {
+			selected[p.ID] = true
+		}
+	}
+	if len(selected) > 0 {
+		f.ProjectIDs = withDescendants(m.allProjects, selected)
+	}
+	return filterRecords(m.records, m.allProjects, f)
+}
+
+// selectedCount returns how many projects the logs are filtered to
+func (m model) selectedCount() int {
+	n := 0
+	for _, p := range m.allProjects {
+		if p.Selected {
+			n++
+		}
+	}
+	return n
+}
+
 func (m model) totalDuration() time.Duration {
 	var total int64
 	for _, r := range m.filteredRecords() {
@@ -96,3 +255,8 @@ func (m model) totalDuration() time.Duration {
 	}
 	return time.Duration(total) * time.Second
 }
+
+// totalEarnings returns what the shown billable records earn
+func (m model) totalEarnings() earnings {
+	return earningsOf(m.filteredRecords(), m.allProjects)
+}
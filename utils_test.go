@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// day returns midnight of a local date
+func day(year int, month time.Month, d int) time.Time {
+	return time.Date(year, month, d, 0, 0, 0, 0, time.Local)
+}
+
+func TestPeriodStartWeek(t *testing.T) {
+	defer func(w time.Weekday) { weekStart = w }(weekStart)
+	for _, tt := range []struct {
+		weekStart time.Weekday
+		now       time.Time
+		want      time.Time
+	}{
+		// 2024-03-10 is a Sunday, 2024-03-11 a Monday
+		{time.Monday, time.Date(2024, 3, 10, 23, 0, 0, 0, time.Local), day(2024, 3, 4)},
+		{time.Monday, day(2024, 3, 11), day(2024, 3, 11)},
+		{time.Sunday, day(2024, 3, 10), day(2024, 3, 10)},
+		{time.Sunday, time.Date(2024, 3, 9, 23, 0, 0, 0, time.Local), day(2024, 3, 3)},
+		{time.Sunday, time.Date(2024, 3, 11, 12, 0, 0, 0, time.Local), day(2024, 3, 10)},
+		// Weeks cross month and year ends
+		{time.Monday, day(2024, 1, 2), day(2024, 1, 1)},
+		{time.Sunday, day(2025, 1, 1), day(2024, 12, 29)},
+	} {
+		weekStart = tt.weekStart
+		if got := periodStart("This week", tt.now); !got.Equal(tt.want) {
+			t.Errorf("week starting %s, now %s: got %s, want %s", tt.weekStart, tt.now.Format("Mon 2006-01-02 15:04"),
+				got.Format("Mon 2006-01-02"), tt.want.Format("Mon 2006-01-02"))
+		}
+	}
+}
+
+func TestPeriodRange(t *testing.T) {
+	defer func(w time.Weekday) { weekStart = w }(weekStart)
+	weekStart = time.Monday
+	now := time.Date(2024, 3, 31, 15, 0, 0, 0, time.Local) // A Sunday
+	for _, tt := range []struct {
+		period   string
+		offset   int
+		from, to time.Time
+	}{
+		{"Today", 0, day(2024, 3, 31), day(2024, 4, 1)},
+		{"Today", -1, day(2024, 3, 30), day(2024, 3, 31)},
+		{"This week", 0, day(2024, 3, 25), day(2024, 4, 1)},
+		{"This week", -1, day(2024, 3, 18), day(2024, 3, 25)},
+		{"This week", 1, day(2024, 4, 1), day(2024, 4, 8)},
+		{"This month", 0, day(2024, 3, 1), day(2024, 4, 1)},
+		{"This month", -1, day(2024, 2, 1), day(2024, 3, 1)},
+		{"This year", -1, day(2023, 1, 1), day(2024, 1, 1)},
+		{"Last 7 days", 0, now.AddDate(0, 0, -7), time.Time{}},
+		{"Last 7 days", -1, now.AddDate(0, 0, -14), now.AddDate(0, 0, -7)},
+		{"All", 0, time.Time{}, time.Time{}},
+	} {
+		from, to := periodRange(tt.period, now, tt.offset)
+		if !from.Equal(tt.from) || !to.Equal(tt.to) {
+			t.Errorf("periodRange(%q, %d) = %s - %s, want %s - %s", tt.period, tt.offset, from, to, tt.from, tt.to)
+		}
+	}
+}